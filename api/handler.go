@@ -7,9 +7,10 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/prodda/prodda/api/middleware"
 	"github.com/prodda/prodda/api/v0"
+	"github.com/prodda/prodda/history"
 	"github.com/prodda/prodda/registry"
+	"github.com/prodda/prodda/schedule"
 	"github.com/pivotal-golang/lager"
-	"gopkg.in/robfig/cron.v2"
 )
 
 var HomeHandleFunc = homeHandleFunc
@@ -18,12 +19,14 @@ func NewHandler(
 	logger lager.Logger,
 	username, password string,
 	taskRegistry registry.TaskRegistry,
-	c *cron.Cron) http.Handler {
+	scheduler *schedule.Scheduler,
+	executor *schedule.Executor,
+	historyStore history.Store) http.Handler {
 
 	r := mux.NewRouter()
 	r.HandleFunc("/", HomeHandleFunc)
 	api := r.PathPrefix("/api").Subrouter()
-	v0.NewSubrouter(api, taskRegistry, c, logger)
+	v0.NewSubrouter(api, taskRegistry, scheduler, executor, historyStore, logger)
 
 	return middleware.Chain{
 		middleware.NewPanicRecovery(logger),
@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/prodda/prodda/api"
+	"github.com/prodda/prodda/schedule"
 	apifakes "github.com/prodda/prodda/api/fakes"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -22,7 +23,7 @@ var _ = Describe("Handler", func() {
 		JustBeforeEach(func() {
 			fakeCron = &cron.Cron{}
 			logger := lagertest.NewTestLogger("Handler Test")
-			handler = api.NewHandler(logger, username, password, nil, fakeCron)
+			handler = api.NewHandler(logger, username, password, nil, schedule.NewScheduler(fakeCron, nil, nil, 0, "", logger), nil, nil)
 		})
 
 		var (
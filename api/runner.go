@@ -1,25 +1,33 @@
 package api
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/pivotal-golang/lager"
 )
 
 type Runner struct {
-	logger  lager.Logger
-	port    uint
-	handler http.Handler
+	logger        lager.Logger
+	port          uint
+	handler       http.Handler
+	shutdownGrace time.Duration
 }
 
-func NewRunner(port uint, handler http.Handler, logger lager.Logger) Runner {
+// NewRunner returns a Runner which serves the handler, and on being signalled
+// stops accepting connections, allowing requests in progress up to
+// shutdownGrace to complete.
+func NewRunner(port uint, handler http.Handler, shutdownGrace time.Duration, logger lager.Logger) Runner {
 	return Runner{
-		logger:  logger,
-		port:    port,
-		handler: handler,
+		logger:        logger,
+		port:          port,
+		handler:       handler,
+		shutdownGrace: shutdownGrace,
 	}
 }
 
@@ -31,10 +39,13 @@ func (a Runner) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
 		a.logger.Info(fmt.Sprintf("API listening on port %d", a.port))
 	}
 
-	errChan := make(chan error)
+	requests := &inFlightRequests{requests: map[*http.Request]string{}}
+	server := &http.Server{Handler: requests.track(a.handler)}
+
+	errChan := make(chan error, 1)
 	go func() {
-		err := http.Serve(listener, a.handler)
-		if err != nil {
+		err := server.Serve(listener)
+		if err != nil && err != http.ErrServerClosed {
 			errChan <- err
 		}
 	}()
@@ -43,8 +54,61 @@ func (a Runner) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
 
 	select {
 	case <-signals:
-		return listener.Close()
+		return a.shutdown(server, requests)
 	case err := <-errChan:
 		return err
 	}
 }
+
+func (a Runner) shutdown(server *http.Server, requests *inFlightRequests) error {
+	a.logger.Info("Waiting for API requests to complete", lager.Data{"grace": a.shutdownGrace.String()})
+
+	ctx, cancel := context.WithTimeout(context.Background(), a.shutdownGrace)
+	defer cancel()
+
+	err := server.Shutdown(ctx)
+	if err == nil {
+		a.logger.Info("API requests completed")
+		return nil
+	}
+	if err != context.DeadlineExceeded {
+		return err
+	}
+
+	a.logger.Info("Abandoning API requests", lager.Data{"requests": requests.list()})
+	return server.Close()
+}
+
+// inFlightRequests tracks the requests in progress, so that those abandoned
+// on shutdown can be logged.
+type inFlightRequests struct {
+	mutex    sync.Mutex
+	requests map[*http.Request]string
+}
+
+func (r *inFlightRequests) track(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		r.mutex.Lock()
+		r.requests[req] = req.Method + " " + req.URL.Path
+		r.mutex.Unlock()
+
+		defer func() {
+			r.mutex.Lock()
+			delete(r.requests, req)
+			r.mutex.Unlock()
+		}()
+
+		handler.ServeHTTP(rw, req)
+	})
+}
+
+func (r *inFlightRequests) list() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	list := []string{}
+	for _, request := range r.requests {
+		list = append(list, request)
+	}
+	return list
+}
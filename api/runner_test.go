@@ -3,14 +3,18 @@ package api_test
 import (
 	"fmt"
 	"net"
+	"net/http"
 	"os"
+	"time"
 
 	"github.com/prodda/prodda/api"
+	"github.com/prodda/prodda/schedule"
 	"github.com/pivotal-golang/lager/lagertest"
 	"gopkg.in/robfig/cron.v2"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gbytes"
 	"github.com/tedsuo/ifrit"
 )
 
@@ -21,8 +25,8 @@ var _ = Describe("APIRunner", func() {
 		username := "username"
 		password := "password"
 		fakeCron := &cron.Cron{}
-		handler := api.NewHandler(logger, username, password, nil, fakeCron)
-		apiRunner := api.NewRunner(uint(apiPort), handler, logger)
+		handler := api.NewHandler(logger, username, password, nil, schedule.NewScheduler(fakeCron, nil, nil, 0, "", logger), nil, nil)
+		apiRunner := api.NewRunner(uint(apiPort), handler, time.Second, logger)
 		apiProcess := ifrit.Invoke(apiRunner)
 		apiProcess.Signal(os.Kill)
 		Eventually(apiProcess.Wait()).Should(Receive())
@@ -30,4 +34,37 @@ var _ = Describe("APIRunner", func() {
 		_, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", apiPort))
 		Expect(err).To(HaveOccurred())
 	})
+
+	It("completes requests in progress when signalled", func() {
+		apiPort := 10100 + GinkgoParallelNode()
+		logger := lagertest.NewTestLogger("APIRunner Test")
+		release := make(chan struct{})
+		handler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			<-release
+			rw.WriteHeader(http.StatusOK)
+		})
+		apiRunner := api.NewRunner(uint(apiPort), handler, time.Minute, logger)
+		apiProcess := ifrit.Invoke(apiRunner)
+
+		responses := make(chan *http.Response, 1)
+		go func() {
+			defer GinkgoRecover()
+			resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/", apiPort))
+			Expect(err).NotTo(HaveOccurred())
+			responses <- resp
+		}()
+		Eventually(logger.Buffer).Should(Say("API listening"))
+		Consistently(responses).ShouldNot(Receive())
+
+		apiProcess.Signal(os.Kill)
+		Eventually(logger.Buffer()).Should(Say("Waiting for API requests"))
+		Consistently(apiProcess.Wait()).ShouldNot(Receive())
+
+		close(release)
+
+		var resp *http.Response
+		Eventually(responses).Should(Receive(&resp))
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Eventually(apiProcess.Wait()).Should(Receive(BeNil()))
+	})
 })
@@ -2,25 +2,42 @@ package v0
 
 import (
 	"github.com/gorilla/mux"
+	"github.com/prodda/prodda/domain"
+	"github.com/prodda/prodda/history"
 	"github.com/prodda/prodda/registry"
+	"github.com/prodda/prodda/schedule"
 	"github.com/pivotal-golang/lager"
-	"gopkg.in/robfig/cron.v2"
 )
 
 func NewSubrouter(
 	parent *mux.Router,
 	taskRegistry registry.TaskRegistry,
-	c *cron.Cron,
+	scheduler *schedule.Scheduler,
+	executor *schedule.Executor,
+	historyStore history.Store,
 	logger lager.Logger) *mux.Router {
 
 	r := parent.PathPrefix("/v0").Subrouter()
 
 	tasks := r.PathPrefix("/tasks").Subrouter()
-	tasks.Handle("/", tasksGetHandler(taskRegistry, logger)).Methods("GET")
-	tasks.Handle("/", tasksCreateHandler(taskRegistry, logger, c)).Methods("POST")
-	tasks.Handle("/{id}", taskGetHandler(taskRegistry, logger)).Methods("GET")
-	tasks.Handle("/{id}", taskUpdateHandler(taskRegistry, logger, c)).Methods("PUT")
-	tasks.Handle("/{id}", taskDeleteHandler(taskRegistry, logger, c)).Methods("DELETE")
+	tasks.Handle("/", tasksGetHandler(taskRegistry, logger, scheduler)).Methods("GET")
+	tasks.Handle("/", tasksCreateHandler(logger, scheduler)).Methods("POST")
+	tasks.Handle("/{id}", taskGetHandler(taskRegistry, logger, scheduler)).Methods("GET")
+	tasks.Handle("/{id}", taskUpdateHandler(taskRegistry, logger, scheduler, domain.DecodeReplacementTask)).Methods("PUT")
+	tasks.Handle("/{id}", taskUpdateHandler(taskRegistry, logger, scheduler, domain.PatchTask)).Methods("PATCH")
+	tasks.Handle("/{id}", taskDeleteHandler(taskRegistry, logger, scheduler)).Methods("DELETE")
+	tasks.Handle("/{id}/runs", taskRunsGetHandler(taskRegistry, historyStore, logger)).Methods("GET")
+	tasks.Handle("/{id}/runs", taskRunsCreateHandler(taskRegistry, executor, logger)).Methods("POST")
+	tasks.Handle("/{id}/pause", taskStateHandler(taskRegistry, logger, scheduler, "pause", (*schedule.Scheduler).Pause)).Methods("POST")
+	tasks.Handle("/{id}/resume", taskStateHandler(taskRegistry, logger, scheduler, "resume", (*schedule.Scheduler).Resume)).Methods("POST")
+
+	schedules := r.PathPrefix("/schedules").Subrouter()
+	schedules.Handle("/validate", schedulesValidateHandler(logger, scheduler)).Methods("POST")
+
+	schedulerRouter := r.PathPrefix("/scheduler").Subrouter()
+	schedulerRouter.Handle("/", schedulerGetHandler(scheduler, logger)).Methods("GET")
+	schedulerRouter.Handle("/pause", schedulerStateHandler(scheduler, logger, "pause", (*schedule.Scheduler).PauseAll)).Methods("POST")
+	schedulerRouter.Handle("/resume", schedulerStateHandler(scheduler, logger, "resume", (*schedule.Scheduler).ResumeAll)).Methods("POST")
 
 	return r
 }
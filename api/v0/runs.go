@@ -0,0 +1,193 @@
+package v0
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/prodda/prodda/domain"
+	"github.com/prodda/prodda/history"
+	"github.com/prodda/prodda/registry"
+	"github.com/prodda/prodda/schedule"
+	"github.com/pivotal-golang/lager"
+)
+
+const (
+	defaultRunsLimit = 20
+	maximumRunsLimit = 100
+)
+
+type runsJSON struct {
+	Total  int              `json:"total"`
+	Offset int              `json:"offset"`
+	Limit  int              `json:"limit"`
+	Runs   []domain.RunJSON `json:"runs"`
+}
+
+func taskRunsGetHandler(registry registry.TaskRegistry, historyStore history.Store, logger lager.Logger) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			logger.Info("Failed to get task runs", lager.Data{"err": err.Error()})
+			rw.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(rw, "ERROR: %v\n", err)
+			return
+		}
+
+		offset, err := queryInt(r, "offset", 0, 0, -1)
+		if err != nil {
+			logger.Info("Failed to get task runs", lager.Data{"err": err.Error()})
+			rw.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(rw, "ERROR: %v\n", err)
+			return
+		}
+
+		limit, err := queryInt(r, "limit", defaultRunsLimit, 1, maximumRunsLimit)
+		if err != nil {
+			logger.Info("Failed to get task runs", lager.Data{"err": err.Error()})
+			rw.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(rw, "ERROR: %v\n", err)
+			return
+		}
+
+		task, err := registry.ByID(uint(id))
+		if err != nil {
+			logger.Error("Failed to find existing task in registry", err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(rw, "ERROR: %v\n", err)
+			return
+		}
+
+		if task == nil {
+			logger.Info("Task not found in registry", lager.Data{"ID": id})
+			rw.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(rw, "ERROR: task not found for ID: %d\n", id)
+			return
+		}
+
+		runs, total, err := historyStore.ByTaskID(task.ID(), offset, limit)
+		if err != nil {
+			logger.Error("Failed to get task runs from history", err, lager.Data{"task": task.AsJSON()})
+			rw.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(rw, "ERROR: %v\n", err)
+			return
+		}
+
+		page := runsJSON{
+			Total:  total,
+			Offset: offset,
+			Limit:  limit,
+			Runs:   make([]domain.RunJSON, len(runs)),
+		}
+		for i := range runs {
+			page.Runs[i] = runs[i].AsJSON()
+		}
+
+		body, err := json.Marshal(page)
+		if err != nil {
+			logger.Error("Failed to serialize task runs", err, lager.Data{"runs": page})
+			rw.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(rw, "ERROR: %v\n", err)
+			return
+		}
+
+		rw.Write(body)
+	})
+}
+
+func taskRunsCreateHandler(registry registry.TaskRegistry, executor *schedule.Executor, logger lager.Logger) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			logger.Info("Failed to run task", lager.Data{"err": err.Error()})
+			rw.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(rw, "ERROR: %v\n", err)
+			return
+		}
+
+		wait, err := queryBool(r, "wait")
+		if err != nil {
+			logger.Info("Failed to run task", lager.Data{"err": err.Error()})
+			rw.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(rw, "ERROR: %v\n", err)
+			return
+		}
+
+		task, err := registry.ByID(uint(id))
+		if err != nil {
+			logger.Error("Failed to find existing task in registry", err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(rw, "ERROR: %v\n", err)
+			return
+		}
+
+		if task == nil {
+			logger.Info("Task not found in registry", lager.Data{"ID": id})
+			rw.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(rw, "ERROR: task not found for ID: %d\n", id)
+			return
+		}
+
+		logger.Info("Task triggered", lager.Data{"task": task.AsJSON(), "wait": wait})
+
+		if !wait {
+			go executor.Execute(task)
+			rw.Header().Set("Location", r.URL.Path)
+			rw.WriteHeader(http.StatusAccepted)
+			return
+		}
+
+		run := executor.Execute(task)
+
+		body, err := json.Marshal(run.AsJSON())
+		if err != nil {
+			logger.Error("Failed to serialize task run", err, lager.Data{"run": run.AsJSON()})
+			rw.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(rw, "ERROR: %v\n", err)
+			return
+		}
+
+		rw.Write(body)
+	})
+}
+
+// queryBool parses the named query parameter of the request,
+// returning false if it is absent.
+func queryBool(r *http.Request, name string) (bool, error) {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return false, nil
+	}
+
+	value, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, fmt.Errorf("Invalid %s: %s", name, s)
+	}
+	return value, nil
+}
+
+// queryInt parses the named query parameter of the request, returning
+// defaultValue if it is absent. A negative max means there is no maximum.
+func queryInt(r *http.Request, name string, defaultValue, min, max int) (int, error) {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return defaultValue, nil
+	}
+
+	value, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid %s: %s", name, s)
+	}
+
+	if max < 0 && value < min {
+		return 0, fmt.Errorf("%s must be at least %d", name, min)
+	}
+
+	if max >= 0 && (value < min || value > max) {
+		return 0, fmt.Errorf("%s must be between %d and %d", name, min, max)
+	}
+
+	return value, nil
+}
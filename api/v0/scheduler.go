@@ -0,0 +1,47 @@
+package v0
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/prodda/prodda/schedule"
+	"github.com/pivotal-golang/lager"
+)
+
+func schedulerGetHandler(scheduler *schedule.Scheduler, logger lager.Logger) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		writeScheduler(rw, scheduler, logger)
+	})
+}
+
+func schedulerStateHandler(
+	scheduler *schedule.Scheduler,
+	logger lager.Logger,
+	action string,
+	change func(scheduler *schedule.Scheduler) error) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		err := change(scheduler)
+		if err != nil {
+			logger.Error("Failed to "+action+" scheduler", err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(rw, "ERROR: %v\n", err)
+			return
+		}
+		logger.Info("Scheduler "+action+"d", lager.Data{"scheduler": scheduler.AsJSON()})
+
+		writeScheduler(rw, scheduler, logger)
+	})
+}
+
+func writeScheduler(rw http.ResponseWriter, scheduler *schedule.Scheduler, logger lager.Logger) {
+	body, err := json.Marshal(scheduler.AsJSON())
+	if err != nil {
+		logger.Error("Failed to serialize scheduler", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(rw, "ERROR: %v\n", err)
+		return
+	}
+
+	rw.Write(body)
+}
@@ -0,0 +1,115 @@
+package v0
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/prodda/prodda/domain"
+	"github.com/prodda/prodda/schedule"
+	"github.com/pivotal-golang/lager"
+	"gopkg.in/robfig/cron.v2"
+)
+
+const (
+	defaultFireTimesCount = 5
+)
+
+type scheduleValidationRequest struct {
+	Schedule string `json:"schedule"`
+	Count    *int   `json:"count"`
+	Timezone string `json:"timezone"`
+}
+
+type scheduleValidationJSON struct {
+	Schedule    string      `json:"schedule"`
+	Description string      `json:"description"`
+	Timezone    string      `json:"timezone"`
+	Next        []time.Time `json:"next"`
+}
+
+func schedulesValidateHandler(logger lager.Logger, scheduler *schedule.Scheduler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			logger.Info("Failed to validate schedule", lager.Data{"err": err.Error()})
+			rw.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(rw, "ERROR: %v\n", err)
+			return
+		}
+
+		var request scheduleValidationRequest
+		err = json.Unmarshal(body, &request)
+		if err != nil {
+			logger.Info("Failed to validate schedule", lager.Data{"err": err.Error()})
+			rw.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(rw, "ERROR: %v\n", err)
+			return
+		}
+
+		count := defaultFireTimesCount
+		if request.Count != nil {
+			count = *request.Count
+		}
+
+		if count < 0 || count > maximumFireTimesPreview {
+			err = fmt.Errorf("count must be between 0 and %d", maximumFireTimesPreview)
+			logger.Info("Failed to validate schedule", lager.Data{"err": err.Error()})
+			rw.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(rw, "ERROR: %v\n", err)
+			return
+		}
+
+		timezone := request.Timezone
+		if timezone == "" {
+			timezone = scheduler.DefaultTimezone()
+		}
+
+		location, err := domain.LoadTimezone(timezone)
+		if err != nil {
+			logger.Info("Invalid timezone", lager.Data{"err": err.Error()})
+			rw.WriteHeader(httpUnprocessableEntity)
+			fmt.Fprintf(rw, "ERROR: %v\n", err)
+			return
+		}
+
+		spec := domain.ScheduleInTimezone(request.Schedule, timezone)
+		parsed, err := domain.ParseSchedule(spec)
+		if err == nil {
+			err = domain.ValidateScheduleFrequency(spec, scheduler.MinimumInterval())
+		}
+		if err != nil {
+			logger.Info("Invalid schedule", lager.Data{"err": err.Error()})
+			rw.WriteHeader(httpUnprocessableEntity)
+			fmt.Fprintf(rw, "ERROR: %v\n", err)
+			return
+		}
+
+		if specSchedule, ok := parsed.(*cron.SpecSchedule); ok {
+			location = specSchedule.Location
+		}
+
+		validation := scheduleValidationJSON{
+			Schedule:    request.Schedule,
+			Description: domain.DescribeSchedule(parsed),
+			Timezone:    location.String(),
+			Next:        domain.NextFireTimes(parsed, time.Now(), count),
+		}
+
+		for i := range validation.Next {
+			validation.Next[i] = validation.Next[i].In(location)
+		}
+
+		responseBody, err := json.Marshal(validation)
+		if err != nil {
+			logger.Error("Failed to serialize schedule validation", err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(rw, "ERROR: %v\n", err)
+			return
+		}
+
+		rw.Write(responseBody)
+	})
+}
@@ -0,0 +1,87 @@
+package v0_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prodda/prodda/api/v0"
+	"github.com/prodda/prodda/domain"
+	"github.com/prodda/prodda/schedule"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+	"gopkg.in/robfig/cron.v2"
+)
+
+var _ = Describe("Schedules", func() {
+	var router *mux.Router
+
+	validate := func(body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("POST", "/v0/schedules/validate", strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	BeforeEach(func() {
+		logger := lagertest.NewTestLogger("Schedules Test")
+		scheduler := schedule.NewScheduler(cron.New(), nil, nil, domain.MinimumTaskFrequency, "", logger)
+
+		router = mux.NewRouter()
+		v0.NewSubrouter(router, nil, scheduler, nil, nil, logger)
+	})
+
+	Describe("POST /schedules/validate", func() {
+		It("describes valid schedules and returns their next fire times in the requested time zone", func() {
+			resp := validate(`{"schedule":"0 30 9 * * mon-fri","count":3,"timezone":"America/New_York"}`)
+			Expect(resp.Code).To(Equal(http.StatusOK))
+
+			var validation struct {
+				Description string      `json:"description"`
+				Timezone    string      `json:"timezone"`
+				Next        []time.Time `json:"next"`
+			}
+			err := json.Unmarshal(resp.Body.Bytes(), &validation)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(validation.Description).To(Equal("At second 0, minute 30, hour 9; on mon-fri (America/New_York)"))
+			Expect(validation.Timezone).To(Equal("America/New_York"))
+			Expect(validation.Next).To(HaveLen(3))
+			Expect(resp.Body.String()).To(MatchRegexp(`"next":\["[^"]*T09:30:00(-04:00|-05:00)"`))
+		})
+
+		It("returns five fire times by default", func() {
+			resp := validate(`{"schedule":"@every 1h30m"}`)
+			Expect(resp.Code).To(Equal(http.StatusOK))
+
+			var validation map[string]interface{}
+			err := json.Unmarshal(resp.Body.Bytes(), &validation)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(validation).To(HaveKeyWithValue("description", "Every 1h30m0s"))
+			Expect(validation["next"]).To(HaveLen(5))
+		})
+
+		It("returns 422 with the parse error for invalid schedules", func() {
+			resp := validate(`{"schedule":"0 61 * * *"}`)
+			Expect(resp.Code).To(Equal(422))
+			Expect(resp.Body.String()).To(ContainSubstring("above maximum"))
+		})
+
+		It("returns 422 for schedules which fire more often than the minimum interval", func() {
+			resp := validate(`{"schedule":"*/30 * * * * *"}`)
+			Expect(resp.Code).To(Equal(422))
+			Expect(resp.Body.String()).To(ContainSubstring("30s apart"))
+		})
+
+		It("returns 422 for unknown time zones", func() {
+			resp := validate(`{"schedule":"@daily","timezone":"Nowhere/Special"}`)
+			Expect(resp.Code).To(Equal(422))
+		})
+	})
+})
@@ -2,24 +2,53 @@ package v0
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"path"
 	"strconv"
-	"time"
 
+	"github.com/gorilla/mux"
 	"github.com/prodda/prodda/domain"
 	"github.com/prodda/prodda/registry"
+	"github.com/prodda/prodda/schedule"
 	"github.com/pivotal-golang/lager"
-	"gopkg.in/robfig/cron.v2"
 )
 
-func taskGetHandler(registry registry.TaskRegistry, logger lager.Logger) http.Handler {
+const (
+	maximumFireTimesPreview = 100
+)
+
+// scheduledTaskJSON adds the fire times of the task to its JSON representation.
+func scheduledTaskJSON(task domain.Task, scheduler *schedule.Scheduler, preview int) (map[string]interface{}, error) {
+	var fields map[string]interface{}
+
+	for _, asJSON := range []interface{}{task.AsJSON(), scheduler.FireTimes(task, preview)} {
+		b, err := json.Marshal(asJSON)
+		if err != nil {
+			return nil, err
+		}
+
+		err = json.Unmarshal(b, &fields)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return fields, nil
+}
+
+func taskGetHandler(registry registry.TaskRegistry, logger lager.Logger, scheduler *schedule.Scheduler) http.Handler {
 	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
-		idString := path.Base(r.URL.String())
-		id, err := strconv.Atoi(idString)
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			logger.Info("Failed to get task", lager.Data{"err": err.Error()})
+			rw.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(rw, "ERROR: %v\n", err)
+			return
+		}
+
+		preview, err := queryInt(r, "preview", 0, 0, maximumFireTimesPreview)
 		if err != nil {
 			logger.Info("Failed to get task", lager.Data{"err": err.Error()})
 			rw.WriteHeader(http.StatusBadRequest)
@@ -42,7 +71,7 @@ func taskGetHandler(registry registry.TaskRegistry, logger lager.Logger) http.Ha
 			return
 		}
 
-		body, err := json.Marshal(task.AsJSON())
+		taskJSON, err := scheduledTaskJSON(task, scheduler, preview)
 		if err != nil {
 			logger.Error("Failed to serialize task", err, lager.Data{"task": task.AsJSON()})
 			rw.WriteHeader(http.StatusInternalServerError)
@@ -50,11 +79,26 @@ func taskGetHandler(registry registry.TaskRegistry, logger lager.Logger) http.Ha
 			return
 		}
 
-		fmt.Fprintf(rw, string(body))
+		body, err := json.Marshal(taskJSON)
+		if err != nil {
+			logger.Error("Failed to serialize task", err, lager.Data{"task": task.AsJSON()})
+			rw.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(rw, "ERROR: %v\n", err)
+			return
+		}
+
+		rw.Write(body)
 	})
 }
 
-func taskUpdateHandler(registry registry.TaskRegistry, logger lager.Logger, c *cron.Cron) http.Handler {
+// replacementDecoder builds a replacement for a task from a request body.
+type replacementDecoder func(task domain.Task, body []byte, logger lager.Logger) (domain.Task, error)
+
+func taskUpdateHandler(
+	registry registry.TaskRegistry,
+	logger lager.Logger,
+	scheduler *schedule.Scheduler,
+	decodeReplacement replacementDecoder) http.Handler {
 	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
 		idString := path.Base(r.URL.String())
 		id, err := strconv.Atoi(idString)
@@ -80,39 +124,99 @@ func taskUpdateHandler(registry registry.TaskRegistry, logger lager.Logger, c *c
 			return
 		}
 
-		decoder := json.NewDecoder(r.Body)
-		var b domain.BaseTaskJson
-
-		err = decoder.Decode(&b)
+		body, err := ioutil.ReadAll(r.Body)
 		if err != nil {
-			logger.Error("Failed to update task", err, lager.Data{"task": task.AsJSON()})
+			logger.Info("Failed to update task", lager.Data{"err": err.Error()})
 			rw.WriteHeader(http.StatusBadRequest)
 			fmt.Fprintf(rw, "ERROR: %v\n", err)
 			return
 		}
 
-		task.SetSchedule(b.Schedule)
-		c.Remove(task.EntryID())
-		entryID, err := c.AddJob(task.Schedule(), task)
+		replacement, err := decodeReplacement(task, body, logger)
+		if err != nil {
+			logger.Info("Failed to update task", lager.Data{"err": err.Error(), "task": task.AsJSON()})
+			switch err.(type) {
+			case domain.UnrecognizedTaskTypeError, domain.TaskTypeChangedError, domain.InvalidScheduleError, domain.InvalidTimezoneError:
+				rw.WriteHeader(httpUnprocessableEntity)
+			default:
+				rw.WriteHeader(http.StatusBadRequest)
+			}
+			fmt.Fprintf(rw, "ERROR: %v\n", err)
+			return
+		}
+
+		err = scheduler.Replace(task.ID(), replacement)
+		if _, ok := err.(domain.ScheduleTooFrequentError); ok {
+			logger.Info("Failed to update task", lager.Data{"err": err.Error(), "task": task.AsJSON()})
+			rw.WriteHeader(httpUnprocessableEntity)
+			fmt.Fprintf(rw, "ERROR: %v\n", err)
+			return
+		}
 		if err != nil {
 			logger.Error(
-				"Failed to schedule task",
+				"Failed to update task",
 				err,
-				lager.Data{"task": task.AsJSON()})
+				lager.Data{"task": task.AsJSON(), "replacement": replacement.AsJSON()})
+			rw.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(rw, "ERROR: %v\n", err)
+			return
+		}
+		logger.Info("task updated", lager.Data{"task": replacement.AsJSON()})
+
+		responseBody, err := json.Marshal(replacement.AsJSON())
+		if err != nil {
+			logger.Error("Failed to serialize task", err, lager.Data{"task": replacement.AsJSON()})
+			rw.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(rw, "ERROR: %v\n", err)
+			return
+		}
+
+		rw.Write(responseBody)
+	})
+}
+
+// taskStateChange changes the state of a task via the scheduler,
+// e.g. by pausing it.
+type taskStateChange func(scheduler *schedule.Scheduler, task domain.Task) error
+
+func taskStateHandler(
+	registry registry.TaskRegistry,
+	logger lager.Logger,
+	scheduler *schedule.Scheduler,
+	action string,
+	change taskStateChange) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			logger.Info("Failed to "+action+" task", lager.Data{"err": err.Error()})
+			rw.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(rw, "ERROR: %v\n", err)
+			return
+		}
+
+		task, err := registry.ByID(uint(id))
+		if err != nil {
+			logger.Error("Failed to find existing task in registry", err)
 			rw.WriteHeader(http.StatusInternalServerError)
 			fmt.Fprintf(rw, "ERROR: %v\n", err)
 			return
 		}
-		task.SetEntryID(entryID)
 
-		task, err = registry.Update(task)
+		if task == nil {
+			logger.Info("Task not found in registry", lager.Data{"ID": id})
+			rw.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(rw, "ERROR: task not found for ID: %d\n", id)
+			return
+		}
+
+		err = change(scheduler, task)
 		if err != nil {
-			logger.Error("Failed to update task in registry", err)
+			logger.Error("Failed to "+action+" task", err, lager.Data{"task": task.AsJSON()})
 			rw.WriteHeader(http.StatusInternalServerError)
 			fmt.Fprintf(rw, "ERROR: %v\n", err)
 			return
 		}
-		logger.Info("task updated", lager.Data{"task": task.AsJSON()})
+		logger.Info("Task "+action+"d", lager.Data{"task": task.AsJSON()})
 
 		body, err := json.Marshal(task.AsJSON())
 		if err != nil {
@@ -122,11 +226,11 @@ func taskUpdateHandler(registry registry.TaskRegistry, logger lager.Logger, c *c
 			return
 		}
 
-		fmt.Fprintf(rw, string(body))
+		rw.Write(body)
 	})
 }
 
-func taskDeleteHandler(registry registry.TaskRegistry, logger lager.Logger, c *cron.Cron) http.Handler {
+func taskDeleteHandler(registry registry.TaskRegistry, logger lager.Logger, scheduler *schedule.Scheduler) http.Handler {
 	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
 		idString := path.Base(r.URL.String())
 		id, err := strconv.Atoi(idString)
@@ -152,9 +256,7 @@ func taskDeleteHandler(registry registry.TaskRegistry, logger lager.Logger, c *c
 			return
 		}
 
-		c.Remove(task.EntryID())
-
-		err = registry.Remove(task)
+		err = scheduler.Remove(task)
 		if err != nil {
 			logger.Error("Failed to remove task from registry", err)
 			rw.WriteHeader(http.StatusInternalServerError)
@@ -167,8 +269,16 @@ func taskDeleteHandler(registry registry.TaskRegistry, logger lager.Logger, c *c
 	})
 }
 
-func tasksGetHandler(registry registry.TaskRegistry, logger lager.Logger) http.Handler {
+func tasksGetHandler(registry registry.TaskRegistry, logger lager.Logger, scheduler *schedule.Scheduler) http.Handler {
 	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		preview, err := queryInt(r, "preview", 0, 0, maximumFireTimesPreview)
+		if err != nil {
+			logger.Info("Failed to get tasks", lager.Data{"err": err.Error()})
+			rw.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(rw, "ERROR: %v\n", err)
+			return
+		}
+
 		allTasks, err := registry.All()
 		if err != nil {
 			logger.Error("Failed to get tasks from registry", err)
@@ -177,9 +287,15 @@ func tasksGetHandler(registry registry.TaskRegistry, logger lager.Logger) http.H
 			return
 		}
 
-		tasksJSON := make([]domain.TaskJSON, len(allTasks))
+		tasksJSON := make([]map[string]interface{}, len(allTasks))
 		for i, _ := range allTasks {
-			tasksJSON[i] = allTasks[i].AsJSON()
+			tasksJSON[i], err = scheduledTaskJSON(allTasks[i], scheduler, preview)
+			if err != nil {
+				logger.Error("Failed to serialize task", err, lager.Data{"task": allTasks[i].AsJSON()})
+				rw.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprintf(rw, "ERROR: %v\n", err)
+				return
+			}
 		}
 
 		body, err := json.Marshal(tasksJSON)
@@ -190,11 +306,11 @@ func tasksGetHandler(registry registry.TaskRegistry, logger lager.Logger) http.H
 			return
 		}
 
-		fmt.Fprintf(rw, string(body))
+		rw.Write(body)
 	})
 }
 
-func tasksCreateHandler(registry registry.TaskRegistry, logger lager.Logger, c *cron.Cron) http.Handler {
+func tasksCreateHandler(logger lager.Logger, scheduler *schedule.Scheduler) http.Handler {
 	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
 		body, err := ioutil.ReadAll(r.Body)
 		if err != nil {
@@ -204,81 +320,31 @@ func tasksCreateHandler(registry registry.TaskRegistry, logger lager.Logger, c *
 			return
 		}
 
-		var b domain.BaseTaskJson
-
-		err = json.Unmarshal(body, &b)
+		task, err := domain.DecodeTask(body, logger)
 		if err != nil {
 			logger.Info("Failed to create task", lager.Data{"err": err.Error()})
-			rw.WriteHeader(http.StatusBadRequest)
-			fmt.Fprintf(rw, "ERROR: %v\n", err)
-			return
-		}
-
-		if b.Schedule == "" {
-			err := errors.New("Schedule must be provided")
-			logger.Info("Failed to create task", lager.Data{"err": err.Error()})
-			rw.WriteHeader(http.StatusBadRequest)
-			fmt.Fprintf(rw, "ERROR: %v\n", err)
-			return
-		}
-
-		if b.Type == "" {
-			err := errors.New("Task type must be provided")
-			logger.Info("Failed to create task", lager.Data{"err": err.Error()})
-			rw.WriteHeader(http.StatusBadRequest)
+			switch err.(type) {
+			case domain.UnrecognizedTaskTypeError, domain.InvalidScheduleError, domain.InvalidTimezoneError:
+				rw.WriteHeader(httpUnprocessableEntity)
+			default:
+				rw.WriteHeader(http.StatusBadRequest)
+			}
 			fmt.Fprintf(rw, "ERROR: %v\n", err)
 			return
 		}
 
-		var task domain.Task
-		switch b.Type {
-		case domain.TravisTaskType:
-			task, err = createTravisTaskConfig(body, logger)
-			if err != nil {
-				logger.Info("Failed to create Travis task", lager.Data{"err": err.Error()})
-				rw.WriteHeader(http.StatusBadRequest)
-				fmt.Fprintf(rw, "ERROR: %v\n", err)
-				return
-			}
-		case domain.NoOpTaskType:
-			task, err = createNoOpTaskConfig(body, logger)
-			if err != nil {
-				logger.Info("Failed to create NoOp task", lager.Data{"err": err.Error()})
-				rw.WriteHeader(http.StatusBadRequest)
-				fmt.Fprintf(rw, "ERROR: %v\n", err)
-				return
-			}
-		case domain.URLGetTaskType:
-			task, err = createURLGetTaskConfig(body, logger)
-			if err != nil {
-				logger.Info("Failed to create URLGet task", lager.Data{"err": err.Error()})
-				rw.WriteHeader(http.StatusBadRequest)
-				fmt.Fprintf(rw, "ERROR: %v\n", err)
-				return
-			}
-		default:
-			err := fmt.Errorf("Unrecognized task type: %s", b.Type)
+		err = scheduler.Add(task)
+		if _, ok := err.(domain.ScheduleTooFrequentError); ok {
 			logger.Info("Failed to create task", lager.Data{"err": err.Error()})
 			rw.WriteHeader(httpUnprocessableEntity)
 			fmt.Fprintf(rw, "ERROR: %v\n", err)
 			return
 		}
-
-		entryID, err := c.AddJob(b.Schedule, task)
 		if err != nil {
 			logger.Error(
-				"Failed to schedule task",
+				"Failed to add task",
 				err,
-				lager.Data{"schedule": b.Schedule, "task": task.AsJSON()})
-			rw.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(rw, "ERROR: %v\n", err)
-			return
-		}
-		task.SetEntryID(entryID)
-
-		err = registry.Add(task)
-		if err != nil {
-			logger.Error("Failed to add task to registry", err, lager.Data{"task": task.AsJSON()})
+				lager.Data{"schedule": task.Schedule(), "task": task.AsJSON()})
 			rw.WriteHeader(http.StatusInternalServerError)
 			fmt.Fprintf(rw, "ERROR: %v\n", err)
 			return
@@ -295,64 +361,7 @@ func tasksCreateHandler(registry registry.TaskRegistry, logger lager.Logger, c *
 		logger.Info("Task created", lager.Data{"task": task.AsJSON()})
 
 		rw.WriteHeader(http.StatusCreated)
-		fmt.Fprintf(rw, string(responseBody))
+		rw.Write(responseBody)
 
 	})
 }
-
-func createTravisTaskConfig(b []byte, logger lager.Logger) (*domain.TravisTask, error) {
-	var task travisTaskConfig
-	err := json.Unmarshal(b, &task)
-	if err != nil {
-		return nil, err
-	}
-
-	if task.Token == "" {
-		return nil, errors.New("Token must be provided")
-	}
-
-	if task.BuildID == 0 {
-		return nil, errors.New("BuildID must be provided")
-	}
-
-	return domain.NewTravisTask(task.Schedule, task.Token, task.BuildID, logger), nil
-}
-
-type travisTaskConfig struct {
-	domain.TravisTaskJSON
-	Token string `json:"token"`
-}
-
-func createNoOpTaskConfig(b []byte, logger lager.Logger) (*domain.NoOpTask, error) {
-	var task domain.NoOpTaskJSON
-	err := json.Unmarshal(b, &task)
-	if err != nil {
-		return nil, err
-	}
-
-	var sleepDuration time.Duration
-	if task.SleepDuration != "" {
-		sleepDuration, err = time.ParseDuration(task.SleepDuration)
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		sleepDuration = 0
-	}
-
-	return domain.NewNoOpTask(task.Schedule, sleepDuration, logger), nil
-}
-
-func createURLGetTaskConfig(b []byte, logger lager.Logger) (*domain.URLGetTask, error) {
-	var task domain.URLGetTaskJSON
-	err := json.Unmarshal(b, &task)
-	if err != nil {
-		return nil, err
-	}
-
-	if task.URL == "" {
-		return nil, errors.New("URL must be provided")
-	}
-
-	return domain.NewURLGetTask(task.Schedule, task.URL, logger), nil
-}
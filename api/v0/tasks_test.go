@@ -0,0 +1,409 @@
+package v0_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prodda/prodda/api/v0"
+	"github.com/prodda/prodda/domain"
+	"github.com/prodda/prodda/history"
+	"github.com/prodda/prodda/registry"
+	"github.com/prodda/prodda/schedule"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+	"gopkg.in/robfig/cron.v2"
+)
+
+var _ = Describe("Tasks", func() {
+	var (
+		router       *mux.Router
+		taskRegistry registry.TaskRegistry
+		historyStore history.Store
+		executor     *schedule.Executor
+		c            *cron.Cron
+	)
+
+	request := func(method, url, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, url, strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	createTask := func(body string) map[string]interface{} {
+		resp := request("POST", "/v0/tasks/", body)
+		Expect(resp.Code).To(Equal(http.StatusCreated))
+
+		var created map[string]interface{}
+		err := json.Unmarshal(resp.Body.Bytes(), &created)
+		Expect(err).NotTo(HaveOccurred())
+		return created
+	}
+
+	BeforeEach(func() {
+		logger := lagertest.NewTestLogger("Tasks Test")
+		taskRegistry = registry.NewInMemoryTaskRegistry(registry.NewSequentialIDGenerator())
+		c = cron.New()
+
+		router = mux.NewRouter()
+		historyStore = history.NewInMemoryStore(0, 0)
+		executor = schedule.NewExecutor(historyStore, logger)
+		scheduler := schedule.NewScheduler(c, taskRegistry, executor, domain.MinimumTaskFrequency, "", logger)
+		v0.NewSubrouter(router, taskRegistry, scheduler, executor, historyStore, logger)
+	})
+
+	Describe("POST /tasks/", func() {
+		It("schedules tasks in their time zone", func() {
+			created := createTask(`{"schedule":"0 0 3 * * *","timezone":"Asia/Tokyo","type":"no-op"}`)
+			Expect(created).To(HaveKeyWithValue("timezone", "Asia/Tokyo"))
+
+			resp := request("GET", fmt.Sprintf("/v0/tasks/%v", created["id"]), "")
+			Expect(resp.Code).To(Equal(http.StatusOK))
+			Expect(resp.Body.String()).To(MatchRegexp(`"nextRun":"[^"]*T03:00:00\+09:00"`))
+		})
+
+		It("returns 422 for unknown time zones", func() {
+			resp := request("POST", "/v0/tasks/", `{"schedule":"@daily","timezone":"Nowhere/Special","type":"no-op"}`)
+			Expect(resp.Code).To(Equal(422))
+		})
+		It("returns 422 for schedules which fire more often than the minimum interval", func() {
+			resp := request("POST", "/v0/tasks/", `{"schedule":"* * * * * ?","type":"no-op"}`)
+			Expect(resp.Code).To(Equal(422))
+			Expect(resp.Body.String()).To(ContainSubstring("minimum interval of 1m0s"))
+			Expect(c.Entries()).To(BeEmpty())
+		})
+	})
+
+	Describe("GET /tasks/:id", func() {
+		var taskURL string
+
+		BeforeEach(func() {
+			created := createTask(`{"schedule":"@every 1h","type":"no-op"}`)
+			taskURL = fmt.Sprintf("/v0/tasks/%d", uint(created["id"].(float64)))
+		})
+
+		It("includes the next fire time of the task", func() {
+			resp := request("GET", taskURL, "")
+			Expect(resp.Code).To(Equal(http.StatusOK))
+
+			var task map[string]interface{}
+			err := json.Unmarshal(resp.Body.Bytes(), &task)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(task).To(HaveKey("nextRun"))
+			Expect(task).NotTo(HaveKey("prevRun"))
+			Expect(task).NotTo(HaveKey("preview"))
+		})
+
+		It("includes a preview of the next fire times when requested", func() {
+			resp := request("GET", taskURL+"?preview=5", "")
+			Expect(resp.Code).To(Equal(http.StatusOK))
+
+			var task struct {
+				NextRun time.Time   `json:"nextRun"`
+				Preview []time.Time `json:"preview"`
+			}
+			err := json.Unmarshal(resp.Body.Bytes(), &task)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(task.Preview).To(HaveLen(5))
+			Expect(task.Preview[0]).To(BeTemporally("==", task.NextRun))
+			Expect(task.Preview[4]).To(BeTemporally("==", task.NextRun.Add(4*time.Hour)))
+		})
+
+		It("includes fire times when getting all tasks", func() {
+			resp := request("GET", "/v0/tasks/?preview=2", "")
+			Expect(resp.Code).To(Equal(http.StatusOK))
+
+			var tasks []map[string]interface{}
+			err := json.Unmarshal(resp.Body.Bytes(), &tasks)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(tasks).To(HaveLen(1))
+			Expect(tasks[0]).To(HaveKey("nextRun"))
+			Expect(tasks[0]["preview"]).To(HaveLen(2))
+		})
+
+		It("returns 400 for an invalid preview", func() {
+			resp := request("GET", taskURL+"?preview=1000", "")
+			Expect(resp.Code).To(Equal(http.StatusBadRequest))
+		})
+	})
+
+	Describe("PUT /tasks/:id", func() {
+		var taskURL string
+
+		BeforeEach(func() {
+			created := createTask(`{"schedule":"@daily","type":"url-get","url":"http://localhost/"}`)
+			taskURL = fmt.Sprintf("/v0/tasks/%v", created["id"])
+		})
+
+		It("replaces the attributes of the task, keeping its ID", func() {
+			resp := request("PUT", taskURL, `{"schedule":"@hourly","type":"url-get","url":"http://example.com/"}`)
+			Expect(resp.Code).To(Equal(http.StatusOK))
+
+			resp = request("GET", taskURL, "")
+			Expect(resp.Code).To(Equal(http.StatusOK))
+
+			var updated domain.URLGetTaskJSON
+			err := json.Unmarshal(resp.Body.Bytes(), &updated)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fmt.Sprintf("/v0/tasks/%d", updated.ID)).To(Equal(taskURL))
+			Expect(updated.Schedule).To(Equal("@hourly"))
+			Expect(updated.URL).To(Equal("http://example.com/"))
+		})
+
+		It("reschedules the task", func() {
+			resp := request("PUT", taskURL, `{"schedule":"@hourly","url":"http://example.com/"}`)
+			Expect(resp.Code).To(Equal(http.StatusOK))
+
+			allTasks, err := taskRegistry.All()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(allTasks).To(HaveLen(1))
+			Expect(c.Entries()).To(HaveLen(1))
+			Expect(c.Entries()[0].ID).To(Equal(allTasks[0].EntryID()))
+		})
+
+		It("validates the replacement using the same rules as creation", func() {
+			resp := request("PUT", taskURL, `{"schedule":"@hourly","type":"url-get"}`)
+			Expect(resp.Code).To(Equal(http.StatusBadRequest))
+
+			resp = request("GET", taskURL, "")
+			Expect(resp.Body.String()).To(ContainSubstring("http://localhost/"))
+		})
+
+		It("returns 422 for invalid schedules", func() {
+			resp := request("PUT", taskURL, `{"schedule":"not-a-schedule"}`)
+			Expect(resp.Code).To(Equal(422))
+		})
+
+		It("does not allow the type of the task to be changed", func() {
+			resp := request("PUT", taskURL, `{"schedule":"@hourly","type":"no-op"}`)
+			Expect(resp.Code).To(Equal(422))
+		})
+
+		It("refuses the redacted representation of a task rather than storing it in place of its secrets", func() {
+			created := createTask(`{"schedule":"@daily","type":"http-request","url":"http://localhost/","headers":{"X-Api-Key":"some-key"}}`)
+			secretURL := fmt.Sprintf("/v0/tasks/%v", created["id"])
+
+			resp := request("GET", secretURL, "")
+			Expect(resp.Code).To(Equal(http.StatusOK))
+			Expect(resp.Body.String()).To(ContainSubstring("REDACTED"))
+
+			resp = request("PUT", secretURL, resp.Body.String())
+			Expect(resp.Code).To(Equal(http.StatusBadRequest))
+			Expect(resp.Body.String()).To(ContainSubstring("Header X-Api-Key must be provided in full, not as REDACTED"))
+
+			task, err := taskRegistry.ByID(uint(created["id"].(float64)))
+			Expect(err).NotTo(HaveOccurred())
+			encoded, err := domain.EncodeTask(task)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(encoded)).To(ContainSubstring("some-key"))
+		})
+
+		It("returns 404 for tasks which do not exist", func() {
+			resp := request("PUT", "/v0/tasks/999", `{"schedule":"@hourly","type":"url-get","url":"http://localhost/"}`)
+			Expect(resp.Code).To(Equal(http.StatusNotFound))
+		})
+	})
+
+	Describe("PATCH /tasks/:id", func() {
+		var taskURL string
+
+		BeforeEach(func() {
+			created := createTask(`{"schedule":"@daily","type":"travis-re-run","token":"some-token","buildID":1234}`)
+			taskURL = fmt.Sprintf("/v0/tasks/%v", created["id"])
+		})
+
+		It("replaces only the provided attributes, retaining secrets", func() {
+			resp := request("PATCH", taskURL, `{"buildID":5678}`)
+			Expect(resp.Code).To(Equal(http.StatusOK))
+
+			var updated domain.TravisTaskJSON
+			err := json.Unmarshal(resp.Body.Bytes(), &updated)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(updated.Schedule).To(Equal("@daily"))
+			Expect(updated.BuildID).To(Equal(uint(5678)))
+
+			task, err := taskRegistry.ByID(updated.ID)
+			Expect(err).NotTo(HaveOccurred())
+			encoded, err := domain.EncodeTask(task)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(encoded)).To(ContainSubstring("some-token"))
+		})
+
+		It("validates the patched task", func() {
+			resp := request("PATCH", taskURL, `{"token":null}`)
+			Expect(resp.Code).To(Equal(http.StatusBadRequest))
+		})
+	})
+
+	Describe("GET /tasks/:id/runs", func() {
+		var (
+			taskID  uint
+			runsURL string
+		)
+
+		BeforeEach(func() {
+			created := createTask(`{"schedule":"@daily","type":"no-op"}`)
+			taskID = uint(created["id"].(float64))
+			runsURL = fmt.Sprintf("/v0/tasks/%d/runs", taskID)
+		})
+
+		It("returns runs of the task, most recent first", func() {
+			task, err := taskRegistry.ByID(taskID)
+			Expect(err).NotTo(HaveOccurred())
+			for i := 0; i < 3; i++ {
+				executor.Execute(task)
+			}
+
+			resp := request("GET", runsURL+"?offset=1&limit=1", "")
+			Expect(resp.Code).To(Equal(http.StatusOK))
+
+			var page struct {
+				Total  int              `json:"total"`
+				Offset int              `json:"offset"`
+				Limit  int              `json:"limit"`
+				Runs   []domain.RunJSON `json:"runs"`
+			}
+			err = json.Unmarshal(resp.Body.Bytes(), &page)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(page.Total).To(Equal(3))
+			Expect(page.Offset).To(Equal(1))
+			Expect(page.Limit).To(Equal(1))
+			Expect(page.Runs).To(HaveLen(1))
+			Expect(page.Runs[0].TaskID).To(Equal(taskID))
+			Expect(page.Runs[0].Outcome).To(Equal(domain.RunSucceeded))
+		})
+
+		It("returns 400 for invalid pagination", func() {
+			resp := request("GET", runsURL+"?limit=0", "")
+			Expect(resp.Code).To(Equal(http.StatusBadRequest))
+
+			resp = request("GET", runsURL+"?offset=-1", "")
+			Expect(resp.Code).To(Equal(http.StatusBadRequest))
+		})
+
+		It("returns 404 for tasks which do not exist", func() {
+			resp := request("GET", "/v0/tasks/999/runs", "")
+			Expect(resp.Code).To(Equal(http.StatusNotFound))
+		})
+	})
+
+	Describe("POST /tasks/:id/runs", func() {
+		var (
+			taskID  uint
+			runsURL string
+		)
+
+		BeforeEach(func() {
+			created := createTask(`{"schedule":"@daily","type":"no-op"}`)
+			taskID = uint(created["id"].(float64))
+			runsURL = fmt.Sprintf("/v0/tasks/%d/runs", taskID)
+		})
+
+		It("runs the task immediately, in the background by default", func() {
+			resp := request("POST", runsURL, "")
+			Expect(resp.Code).To(Equal(http.StatusAccepted))
+			Expect(resp.Header().Get("Location")).To(Equal(runsURL))
+
+			Eventually(func() int {
+				_, total, _ := historyStore.ByTaskID(taskID, 0, 1)
+				return total
+			}).Should(Equal(1))
+		})
+
+		It("returns the run when waiting for the task to complete", func() {
+			resp := request("POST", runsURL+"?wait=true", "")
+			Expect(resp.Code).To(Equal(http.StatusOK))
+
+			var run domain.RunJSON
+			err := json.Unmarshal(resp.Body.Bytes(), &run)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(run.TaskID).To(Equal(taskID))
+			Expect(run.Outcome).To(Equal(domain.RunSucceeded))
+
+			_, total, err := historyStore.ByTaskID(taskID, 0, 1)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(total).To(Equal(1))
+		})
+
+		It("does not affect the schedule of the task", func() {
+			entries := c.Entries()
+
+			resp := request("POST", runsURL+"?wait=true", "")
+			Expect(resp.Code).To(Equal(http.StatusOK))
+			Expect(c.Entries()).To(Equal(entries))
+		})
+
+		It("returns 404 for tasks which do not exist", func() {
+			resp := request("POST", "/v0/tasks/999/runs", "")
+			Expect(resp.Code).To(Equal(http.StatusNotFound))
+		})
+	})
+
+	Describe("POST /tasks/:id/pause and /resume", func() {
+		var taskURL string
+
+		BeforeEach(func() {
+			created := createTask(`{"schedule":"@daily","type":"no-op"}`)
+			taskURL = fmt.Sprintf("/v0/tasks/%d", uint(created["id"].(float64)))
+		})
+
+		It("unschedules the task while it is paused", func() {
+			resp := request("POST", taskURL+"/pause", "")
+			Expect(resp.Code).To(Equal(http.StatusOK))
+			Expect(resp.Body.String()).To(ContainSubstring(`"paused":true`))
+			Expect(c.Entries()).To(BeEmpty())
+
+			resp = request("GET", taskURL, "")
+			Expect(resp.Code).To(Equal(http.StatusOK))
+			Expect(resp.Body.String()).To(ContainSubstring(`"paused":true`))
+
+			resp = request("POST", taskURL+"/resume", "")
+			Expect(resp.Code).To(Equal(http.StatusOK))
+			Expect(resp.Body.String()).To(ContainSubstring(`"paused":false`))
+			Expect(c.Entries()).To(HaveLen(1))
+		})
+
+		It("keeps the task paused when it is replaced", func() {
+			resp := request("POST", taskURL+"/pause", "")
+			Expect(resp.Code).To(Equal(http.StatusOK))
+
+			resp = request("PUT", taskURL, `{"schedule":"@hourly"}`)
+			Expect(resp.Code).To(Equal(http.StatusOK))
+			Expect(resp.Body.String()).To(ContainSubstring(`"paused":true`))
+			Expect(c.Entries()).To(BeEmpty())
+		})
+
+		It("returns 404 for tasks which do not exist", func() {
+			resp := request("POST", "/v0/tasks/999/pause", "")
+			Expect(resp.Code).To(Equal(http.StatusNotFound))
+		})
+	})
+
+	Describe("POST /scheduler/pause and /resume", func() {
+		It("unschedules all tasks while the scheduler is paused", func() {
+			createTask(`{"schedule":"@daily","type":"no-op"}`)
+
+			resp := request("POST", "/v0/scheduler/pause", "")
+			Expect(resp.Code).To(Equal(http.StatusOK))
+			Expect(resp.Body.String()).To(MatchJSON(`{"paused":true}`))
+			Expect(c.Entries()).To(BeEmpty())
+
+			resp = request("GET", "/v0/scheduler/", "")
+			Expect(resp.Code).To(Equal(http.StatusOK))
+			Expect(resp.Body.String()).To(MatchJSON(`{"paused":true}`))
+
+			resp = request("POST", "/v0/scheduler/resume", "")
+			Expect(resp.Code).To(Equal(http.StatusOK))
+			Expect(resp.Body.String()).To(MatchJSON(`{"paused":false}`))
+			Expect(c.Entries()).To(HaveLen(1))
+		})
+	})
+})
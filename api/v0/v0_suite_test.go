@@ -0,0 +1,13 @@
+package v0_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestV0(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "API v0 Suite")
+}
@@ -0,0 +1,172 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	travisAPI = "Travis"
+	gitHubAPI = "GitHub"
+)
+
+// AuthenticationError is returned when an API, e.g. "Travis", rejects the
+// token, either because it is invalid (401) or lacks permission (403).
+type AuthenticationError struct {
+	API     string
+	Status  int
+	Message string
+}
+
+func (e AuthenticationError) Error() string {
+	return fmt.Sprintf("%s authentication failed with status code %d: %s", e.API, e.Status, e.Message)
+}
+
+func (e AuthenticationError) StatusCode() int {
+	return e.Status
+}
+
+// NotFoundError is returned when the resource, e.g. a build, does not exist,
+// or is not visible to the token.
+type NotFoundError struct {
+	API     string
+	Message string
+}
+
+func (e NotFoundError) Error() string {
+	return fmt.Sprintf("%s resource not found: %s", e.API, e.Message)
+}
+
+func (e NotFoundError) StatusCode() int {
+	return http.StatusNotFound
+}
+
+// RateLimitedError is returned when an API rejects requests because
+// too many have been made. RetryAfter is zero if the API did not specify when
+// requests would next be accepted.
+type RateLimitedError struct {
+	API        string
+	RetryAfter time.Duration
+	Message    string
+}
+
+func (e RateLimitedError) Error() string {
+	if e.RetryAfter == 0 {
+		return fmt.Sprintf("%s rate limit exceeded: %s", e.API, e.Message)
+	}
+	return fmt.Sprintf("%s rate limit exceeded, retry after %s: %s", e.API, e.RetryAfter, e.Message)
+}
+
+func (e RateLimitedError) StatusCode() int {
+	return http.StatusTooManyRequests
+}
+
+// UnexpectedStatusCodeError is returned for any other unsuccessful response.
+type UnexpectedStatusCodeError struct {
+	API     string
+	Status  int
+	Message string
+}
+
+func (e UnexpectedStatusCodeError) Error() string {
+	return fmt.Sprintf("%s API returned status code %d: %s", e.API, e.Status, e.Message)
+}
+
+func (e UnexpectedStatusCodeError) StatusCode() int {
+	return e.Status
+}
+
+// do makes the request to api via httpClient, returning a typed error if the
+// response is unsuccessful, and otherwise decoding it into response, unless
+// response is nil.
+func do(
+	ctx context.Context,
+	httpClient *http.Client,
+	api string,
+	request *http.Request,
+	response interface{},
+) error {
+	resp, err := httpClient.Do(request.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	err = checkResponse(api, resp, respBody)
+	if err != nil || response == nil {
+		return err
+	}
+
+	return json.Unmarshal(respBody, response)
+}
+
+// checkResponse returns a typed error for unsuccessful responses from api,
+// given the body which has already been read from them.
+func checkResponse(api string, resp *http.Response, body []byte) error {
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return nil
+	}
+
+	message := errorMessage(resp, body)
+
+	switch resp.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return AuthenticationError{API: api, Status: resp.StatusCode, Message: message}
+	case http.StatusNotFound:
+		return NotFoundError{API: api, Message: message}
+	case http.StatusTooManyRequests:
+		return RateLimitedError{API: api, RetryAfter: retryAfter(resp.Header.Get("Retry-After")), Message: message}
+	default:
+		return UnexpectedStatusCodeError{API: api, Status: resp.StatusCode, Message: message}
+	}
+}
+
+// errorMessage returns the message of a Travis v3 or v2 API error, or of a
+// GitHub API error, falling back to the status of the response, since the
+// body of errors returned by proxies may be an arbitrarily long HTML page.
+func errorMessage(resp *http.Response, body []byte) string {
+	var apiError struct {
+		V3Message     string `json:"error_message"`
+		V2Message     string `json:"error"`
+		GitHubMessage string `json:"message"`
+	}
+
+	if json.Unmarshal(body, &apiError) == nil {
+		for _, message := range []string{apiError.V3Message, apiError.V2Message, apiError.GitHubMessage} {
+			if message != "" {
+				return message
+			}
+		}
+	}
+
+	return resp.Status
+}
+
+// retryAfter parses the value of a Retry-After header, which is either a
+// number of seconds or an HTTP date, returning zero if it is absent or
+// invalid.
+func retryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(header); err == nil && date.After(time.Now()) {
+		return time.Until(date).Round(time.Second)
+	}
+
+	return 0
+}
@@ -0,0 +1,73 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+type GitHub struct {
+	url        string
+	httpClient *http.Client
+}
+
+// NewGitHubClient returns a client of the GitHub REST API at apiServer, e.g.
+// "https://api.github.com" or "https://github.example.com/api/v3" for
+// GitHub Enterprise.
+func NewGitHubClient(apiServer string) *GitHub {
+	return NewGitHubClientWithHTTPClient(apiServer, &http.Client{Timeout: DefaultTimeout})
+}
+
+// NewGitHubClientWithHTTPClient returns a client which makes requests via
+// httpClient, e.g. to configure its timeout or transport.
+func NewGitHubClientWithHTTPClient(apiServer string, httpClient *http.Client) *GitHub {
+	return &GitHub{
+		url:        apiServer,
+		httpClient: httpClient,
+	}
+}
+
+// WorkflowDispatch describes a run of a GitHub Actions workflow. Ref is the
+// branch or tag to run the workflow on; Inputs are optional, and must be
+// declared by the workflow.
+type WorkflowDispatch struct {
+	Ref    string            `json:"ref"`
+	Inputs map[string]string `json:"inputs,omitempty"`
+}
+
+// DispatchWorkflow triggers a run of the workflow of the repository, where
+// workflow is the file name of the workflow, e.g. "nightly.yml", or its ID.
+func (g *GitHub) DispatchWorkflow(
+	ctx context.Context,
+	token string,
+	owner string,
+	repo string,
+	workflow string,
+	dispatch WorkflowDispatch,
+) error {
+	URL := fmt.Sprintf(
+		"%s/repos/%s/%s/actions/workflows/%s/dispatches",
+		g.url,
+		url.PathEscape(owner),
+		url.PathEscape(repo),
+		url.PathEscape(workflow))
+
+	requestBody, err := json.Marshal(dispatch)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest("POST", URL, bytes.NewReader(requestBody))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	request.Header.Set("Accept", "application/vnd.github+json")
+	request.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	request.Header.Set("Content-Type", "application/json")
+
+	return do(ctx, g.httpClient, gitHubAPI, request, nil)
+}
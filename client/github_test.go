@@ -0,0 +1,76 @@
+package client_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/prodda/prodda/client"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GitHub", func() {
+	var (
+		server       *httptest.Server
+		gitHubClient *client.GitHub
+		requests     chan *http.Request
+		bodies       chan []byte
+	)
+
+	serve := func(statusCode int, response string) {
+		received := make(chan *http.Request, 1)
+		receivedBodies := make(chan []byte, 1)
+		requests = received
+		bodies = receivedBodies
+
+		server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			requestBody, _ := ioutil.ReadAll(r.Body)
+			received <- r
+			receivedBodies <- requestBody
+
+			rw.WriteHeader(statusCode)
+			rw.Write([]byte(response))
+		}))
+		gitHubClient = client.NewGitHubClient(server.URL)
+	}
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("dispatches the workflow", func() {
+		serve(http.StatusNoContent, "")
+
+		err := gitHubClient.DispatchWorkflow(context.Background(), "some-token", "prodda", "prodda", "nightly.yml", client.WorkflowDispatch{
+			Ref:    "main",
+			Inputs: map[string]string{"environment": "production"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		var request *http.Request
+		Expect(requests).To(Receive(&request))
+		Expect(request.Method).To(Equal("POST"))
+		Expect(request.URL.Path).To(Equal("/repos/prodda/prodda/actions/workflows/nightly.yml/dispatches"))
+		Expect(request.Header.Get("Authorization")).To(Equal("Bearer some-token"))
+		Expect(request.Header.Get("Accept")).To(Equal("application/vnd.github+json"))
+		Expect(bodies).To(Receive(MatchJSON(`{"ref": "main", "inputs": {"environment": "production"}}`)))
+	})
+
+	It("returns errors with the status code and message of unsuccessful responses", func() {
+		serve(http.StatusUnprocessableEntity, `{"message": "No ref found for: missing"}`)
+
+		err := gitHubClient.DispatchWorkflow(context.Background(), "some-token", "prodda", "prodda", "nightly.yml", client.WorkflowDispatch{Ref: "missing"})
+		Expect(err).To(MatchError("GitHub API returned status code 422: No ref found for: missing"))
+		Expect(err.(client.UnexpectedStatusCodeError).StatusCode()).To(Equal(http.StatusUnprocessableEntity))
+	})
+
+	It("returns the same typed errors as the Travis client", func() {
+		serve(http.StatusUnauthorized, `{"message": "Bad credentials"}`)
+
+		err := gitHubClient.DispatchWorkflow(context.Background(), "bad-token", "prodda", "prodda", "nightly.yml", client.WorkflowDispatch{Ref: "main"})
+		Expect(err).To(Equal(client.AuthenticationError{API: "GitHub", Status: http.StatusUnauthorized, Message: "Bad credentials"}))
+	})
+})
@@ -1,70 +1,182 @@
 package client
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"net/http"
-	"strings"
+	"net/url"
+	"time"
 )
 
+// DefaultTimeout limits requests made by clients created via NewTravisClient
+// or NewGitHubClient, including reading the response.
+const DefaultTimeout = 30 * time.Second
+
 type Build struct {
-	Id    int    `json:"id"`
-	State string `json:"state"`
+	Id         int    `json:"id"`
+	State      string `json:"state"`
+	StartedAt  string `json:"started_at,omitempty"`
+	FinishedAt string `json:"finished_at,omitempty"`
 }
 
 type Travis struct {
-	url string
+	url        string
+	httpClient *http.Client
 }
 
 func NewTravisClient(apiServer string) *Travis {
-	return &Travis{apiServer}
+	return NewTravisClientWithHTTPClient(apiServer, &http.Client{Timeout: DefaultTimeout})
 }
 
-type RestartNotice struct {
-	Notice string `json:"notice"`
-	Error  string `json:"error"`
+// NewTravisClientWithHTTPClient returns a client which makes requests via
+// httpClient, e.g. to configure its timeout or transport.
+func NewTravisClientWithHTTPClient(apiServer string, httpClient *http.Client) *Travis {
+	return &Travis{
+		url:        apiServer,
+		httpClient: httpClient,
+	}
 }
 
+// RestartResponse describes a restart of a build accepted by the Travis v3
+// API.
 type RestartResponse struct {
-	Result bool            `json:"result"`
-	Flash  []RestartNotice `json:"flash"`
+	Type         string `json:"@type"`
+	Build        Build  `json:"build"`
+	StateChange  string `json:"state_change"`
+	ResourceType string `json:"resource_type"`
 }
 
-func (t *Travis) TriggerBuild(travisToken string, buildId uint) (*RestartResponse, error) {
-	URL := fmt.Sprintf("%s/requests", t.url)
-	formBody := fmt.Sprintf(`{"build_id": %d}`, buildId)
-	body := ioutil.NopCloser(strings.NewReader(formBody))
+// TriggerBuild re-runs the build with the given ID via the Travis v3 API.
+// Travis refuses to re-run builds with an unsuccessful response, e.g. if the
+// build is already running.
+func (t *Travis) TriggerBuild(ctx context.Context, travisToken string, buildId uint) (*RestartResponse, error) {
+	var response RestartResponse
+	err := t.v3Request(ctx, travisToken, "POST", fmt.Sprintf("/build/%d/restart", buildId), nil, &response)
+	if err != nil {
+		return nil, err
+	}
 
-	request, err := http.NewRequest(
-		"POST",
-		URL,
-		body)
+	return &response, nil
+}
+
+// BuildRequest describes a new build of a branch, triggered via the
+// Travis v3 API. Message and Config are optional; Config is merged with
+// the .travis.yml of the branch.
+type BuildRequest struct {
+	Branch  string                 `json:"branch"`
+	Message string                 `json:"message,omitempty"`
+	Config  map[string]interface{} `json:"config,omitempty"`
+}
+
+type BuildRequestResponse struct {
+	Type              string           `json:"@type"`
+	RemainingRequests int              `json:"remaining_requests"`
+	Request           BuildRequestInfo `json:"request"`
+}
+
+type BuildRequestInfo struct {
+	Id      int    `json:"id"`
+	Branch  string `json:"branch"`
+	Message string `json:"message"`
+}
+
+// BuildRequestStatus describes the progress of a build request. Builds is
+// empty until Travis has created the builds for the request.
+type BuildRequestStatus struct {
+	Id     int     `json:"id"`
+	State  string  `json:"state"`
+	Result string  `json:"result"`
+	Builds []Build `json:"builds"`
+}
 
+// TriggerBranchBuild requests a new build of the branch of the repository with
+// the given slug, e.g. "prodda/prodda", via the Travis v3 API.
+func (t *Travis) TriggerBranchBuild(
+	ctx context.Context,
+	travisToken string,
+	slug string,
+	buildRequest BuildRequest,
+) (*BuildRequestResponse, error) {
+	var response BuildRequestResponse
+	err := t.v3Request(
+		ctx,
+		travisToken,
+		"POST",
+		fmt.Sprintf("/repo/%s/requests", url.PathEscape(slug)),
+		map[string]BuildRequest{"request": buildRequest},
+		&response)
 	if err != nil {
 		return nil, err
 	}
-	request.Header.Set("Authorization", fmt.Sprintf("token %s", travisToken))
-	request.Header.Set("Accept", "application/json; version=2")
-	request.Header.Set("Content-Type", "application/json")
 
-	client := http.Client{}
-	resp, err := client.Do(request)
+	return &response, nil
+}
+
+// BuildRequestStatus returns the progress of the build request with the given
+// ID, as returned by TriggerBranchBuild, via the Travis v3 API.
+func (t *Travis) BuildRequestStatus(
+	ctx context.Context,
+	travisToken string,
+	slug string,
+	requestID int,
+) (*BuildRequestStatus, error) {
+	var status BuildRequestStatus
+	err := t.v3Request(
+		ctx,
+		travisToken,
+		"GET",
+		fmt.Sprintf("/repo/%s/request/%d", url.PathEscape(slug), requestID),
+		nil,
+		&status)
 	if err != nil {
 		return nil, err
 	}
 
-	defer resp.Body.Close()
-	respBody, err := ioutil.ReadAll(resp.Body)
+	return &status, nil
+}
+
+// Build returns the build with the given ID via the Travis v3 API.
+func (t *Travis) Build(ctx context.Context, travisToken string, buildID int) (*Build, error) {
+	var build Build
+	err := t.v3Request(ctx, travisToken, "GET", fmt.Sprintf("/build/%d", buildID), nil, &build)
 	if err != nil {
 		return nil, err
 	}
 
-	var restartResponse RestartResponse
-	err = json.Unmarshal(respBody, &restartResponse)
+	return &build, nil
+}
+
+// v3Request makes a request to the Travis v3 API, sending requestBody, if it is
+// not nil, and decoding the response into response.
+func (t *Travis) v3Request(
+	ctx context.Context,
+	travisToken string,
+	method string,
+	path string,
+	requestBody interface{},
+	response interface{},
+) error {
+	var body io.Reader
+	if requestBody != nil {
+		b, err := json.Marshal(requestBody)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	request, err := http.NewRequest(method, t.url+path, body)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	request.Header.Set("Authorization", fmt.Sprintf("token %s", travisToken))
+	request.Header.Set("Travis-API-Version", "3")
+	if requestBody != nil {
+		request.Header.Set("Content-Type", "application/json")
 	}
 
-	return &restartResponse, nil
+	return do(ctx, t.httpClient, travisAPI, request, response)
 }
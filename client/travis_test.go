@@ -0,0 +1,224 @@
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/prodda/prodda/client"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Travis", func() {
+	var (
+		server       *httptest.Server
+		travisClient *client.Travis
+		requests     chan *http.Request
+		bodies       chan []byte
+	)
+
+	serve := func(statusCode int, response string) {
+		received := make(chan *http.Request, 1)
+		receivedBodies := make(chan []byte, 1)
+		requests = received
+		bodies = receivedBodies
+
+		server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			requestBody, _ := ioutil.ReadAll(r.Body)
+			received <- r
+			receivedBodies <- requestBody
+
+			rw.WriteHeader(statusCode)
+			rw.Write([]byte(response))
+		}))
+		travisClient = client.NewTravisClient(server.URL)
+	}
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Describe("triggering a build of a branch", func() {
+		It("requests a build via the v3 API", func() {
+			serve(http.StatusAccepted, `{
+				"@type": "pending",
+				"remaining_requests": 9,
+				"request": {"id": 1234, "branch": "master", "message": "Nightly build"}
+			}`)
+
+			resp, err := travisClient.TriggerBranchBuild(context.Background(), "some-token", "prodda/prodda", client.BuildRequest{
+				Branch:  "master",
+				Message: "Nightly build",
+				Config:  map[string]interface{}{"env": "NIGHTLY=true"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Type).To(Equal("pending"))
+			Expect(resp.RemainingRequests).To(Equal(9))
+			Expect(resp.Request.Id).To(Equal(1234))
+
+			var request *http.Request
+			Expect(requests).To(Receive(&request))
+			Expect(request.Method).To(Equal("POST"))
+			Expect(request.URL.EscapedPath()).To(Equal("/repo/prodda%2Fprodda/requests"))
+			Expect(request.Header.Get("Authorization")).To(Equal("token some-token"))
+			Expect(request.Header.Get("Travis-API-Version")).To(Equal("3"))
+
+			var body []byte
+			Expect(bodies).To(Receive(&body))
+
+			var fields map[string]interface{}
+			Expect(json.Unmarshal(body, &fields)).To(Succeed())
+			Expect(fields).To(Equal(map[string]interface{}{
+				"request": map[string]interface{}{
+					"branch":  "master",
+					"message": "Nightly build",
+					"config":  map[string]interface{}{"env": "NIGHTLY=true"},
+				},
+			}))
+		})
+
+		It("returns an error for unsuccessful responses", func() {
+			serve(http.StatusNotFound, `{"@type": "error", "error_type": "not_found", "error_message": "repository not found (or insufficient access)"}`)
+
+			_, err := travisClient.TriggerBranchBuild(context.Background(), "some-token", "prodda/missing", client.BuildRequest{Branch: "master"})
+			Expect(err).To(Equal(client.NotFoundError{API: "Travis", Message: "repository not found (or insufficient access)"}))
+		})
+	})
+
+	Describe("re-running a build", func() {
+		It("requests a restart via the v3 API", func() {
+			serve(http.StatusAccepted, `{
+				"@type": "pending",
+				"build": {"@type": "build", "@representation": "minimal", "id": 1234, "state": "passed"},
+				"state_change": "restart",
+				"resource_type": "build"
+			}`)
+
+			resp, err := travisClient.TriggerBuild(context.Background(), "some-token", 1234)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Type).To(Equal("pending"))
+			Expect(resp.StateChange).To(Equal("restart"))
+			Expect(resp.Build).To(Equal(client.Build{Id: 1234, State: "passed"}))
+
+			var request *http.Request
+			Expect(requests).To(Receive(&request))
+			Expect(request.Method).To(Equal("POST"))
+			Expect(request.URL.Path).To(Equal("/build/1234/restart"))
+			Expect(request.Header.Get("Authorization")).To(Equal("token some-token"))
+			Expect(request.Header.Get("Travis-API-Version")).To(Equal("3"))
+			Expect(bodies).To(Receive(BeEmpty()))
+		})
+
+		It("returns refusals to re-run the build as errors", func() {
+			serve(http.StatusConflict, `{"@type": "error", "error_type": "job_already_running", "error_message": "build already running, cannot restart"}`)
+
+			resp, err := travisClient.TriggerBuild(context.Background(), "some-token", 1234)
+			Expect(err).To(Equal(client.UnexpectedStatusCodeError{API: "Travis", Status: http.StatusConflict, Message: "build already running, cannot restart"}))
+			Expect(resp).To(BeNil())
+		})
+	})
+
+	Describe("unsuccessful responses", func() {
+		trigger := func() error {
+			_, err := travisClient.TriggerBuild(context.Background(), "some-token", 1234)
+			return err
+		}
+
+		It("returns authentication errors", func() {
+			serve(http.StatusUnauthorized, "<html>Unauthorized</html>")
+			Expect(trigger()).To(Equal(client.AuthenticationError{API: "Travis", Status: http.StatusUnauthorized, Message: "401 Unauthorized"}))
+			server.Close()
+
+			serve(http.StatusForbidden, `{"error": "access denied"}`)
+			Expect(trigger()).To(MatchError("Travis authentication failed with status code 403: access denied"))
+		})
+
+		It("returns not found errors", func() {
+			serve(http.StatusNotFound, "<html>Not Found</html>")
+
+			err := trigger()
+			Expect(err).To(BeAssignableToTypeOf(client.NotFoundError{}))
+			Expect(err.(client.NotFoundError).StatusCode()).To(Equal(http.StatusNotFound))
+		})
+
+		It("returns rate limited errors with the delay before retrying", func() {
+			server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				rw.Header().Set("Retry-After", "120")
+				rw.WriteHeader(http.StatusTooManyRequests)
+			}))
+			travisClient = client.NewTravisClient(server.URL)
+
+			err := trigger()
+			Expect(err).To(Equal(client.RateLimitedError{API: "Travis", RetryAfter: 2 * time.Minute, Message: "429 Too Many Requests"}))
+			Expect(err).To(MatchError("Travis rate limit exceeded, retry after 2m0s: 429 Too Many Requests"))
+		})
+
+		It("returns errors with the status code of other responses", func() {
+			serve(http.StatusBadGateway, "<html>Bad Gateway</html>")
+
+			err := trigger()
+			Expect(err).To(MatchError("Travis API returned status code 502: 502 Bad Gateway"))
+			Expect(err.(client.UnexpectedStatusCodeError).StatusCode()).To(Equal(http.StatusBadGateway))
+		})
+	})
+
+	It("makes requests via the configured HTTP client", func() {
+		server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			time.Sleep(100 * time.Millisecond)
+		}))
+		travisClient = client.NewTravisClientWithHTTPClient(server.URL, &http.Client{Timeout: 10 * time.Millisecond})
+
+		_, err := travisClient.Build(context.Background(), "some-token", 5678)
+		Expect(err).To(HaveOccurred())
+		Expect(err.(net.Error).Timeout()).To(BeTrue())
+	})
+
+	Describe("polling a build request", func() {
+		It("returns the builds created for the request", func() {
+			serve(http.StatusOK, `{
+				"@type": "request",
+				"id": 1234,
+				"state": "processed",
+				"result": "approved",
+				"builds": [{"@type": "build", "id": 5678, "state": "started"}]
+			}`)
+
+			status, err := travisClient.BuildRequestStatus(context.Background(), "some-token", "prodda/prodda", 1234)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(status.State).To(Equal("processed"))
+			Expect(status.Builds).To(Equal([]client.Build{{Id: 5678, State: "started"}}))
+
+			var request *http.Request
+			Expect(requests).To(Receive(&request))
+			Expect(request.Method).To(Equal("GET"))
+			Expect(request.URL.EscapedPath()).To(Equal("/repo/prodda%2Fprodda/request/1234"))
+			Expect(request.Header.Get("Travis-API-Version")).To(Equal("3"))
+		})
+	})
+
+	Describe("polling a build", func() {
+		It("returns the state of the build", func() {
+			serve(http.StatusOK, `{"@type": "build", "id": 5678, "state": "passed", "started_at": "2015-06-01T10:00:00Z", "finished_at": "2015-06-01T10:05:00Z"}`)
+
+			build, err := travisClient.Build(context.Background(), "some-token", 5678)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(build).To(Equal(&client.Build{
+				Id:         5678,
+				State:      "passed",
+				StartedAt:  "2015-06-01T10:00:00Z",
+				FinishedAt: "2015-06-01T10:05:00Z",
+			}))
+
+			var request *http.Request
+			Expect(requests).To(Receive(&request))
+			Expect(request.URL.Path).To(Equal("/build/5678"))
+			Expect(request.Header.Get("Authorization")).To(Equal("token some-token"))
+		})
+	})
+})
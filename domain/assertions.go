@@ -0,0 +1,318 @@
+package domain
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Assertions determine whether the response to a request made by a task
+// indicates success. Every assertion is optional; the execution fails if
+// any assertion which is given is not met.
+type Assertions struct {
+	// StatusCodes lists the acceptable status codes, each as a code, e.g.
+	// "204", a class, e.g. "2xx", or an inclusive range, e.g. "200-299".
+	StatusCodes  []string
+	statusRanges []statusRange
+
+	BodyContains string
+	BodyMatches  *regexp.Regexp
+
+	// JSON maps paths within the response body, e.g. "data.items[0].name",
+	// to the values expected at them.
+	JSON map[string]interface{}
+
+	MaxLatency time.Duration
+
+	// CertValidFor is the minimum remaining validity of the TLS certificate
+	// of the server.
+	CertValidFor time.Duration
+}
+
+type AssertionsJSON struct {
+	StatusCodes  []string               `json:"statusCodes,omitempty"`
+	BodyContains string                 `json:"bodyContains,omitempty"`
+	BodyMatches  string                 `json:"bodyMatches,omitempty"`
+	JSON         map[string]interface{} `json:"json,omitempty"`
+	MaxLatency   string                 `json:"maxLatency,omitempty"`
+	CertValidFor string                 `json:"certValidFor,omitempty"`
+}
+
+type statusRange struct {
+	min int
+	max int
+}
+
+// AssertionFailedError is returned when a response does not meet an assertion.
+type AssertionFailedError struct {
+	Assertion string
+	Message   string
+}
+
+func (e AssertionFailedError) Error() string {
+	return fmt.Sprintf("Assertion %s failed: %s", e.Assertion, e.Message)
+}
+
+// UnexpectedStatusCodeError is returned when the status code of a response
+// is not one of those asserted. It is a StatusCodeError, so that responses
+// with a 5xx status code can be retried.
+type UnexpectedStatusCodeError struct {
+	Status   int
+	Expected []string
+}
+
+func (e UnexpectedStatusCodeError) Error() string {
+	return fmt.Sprintf(
+		"Assertion statusCodes failed: got %d, expected %s",
+		e.Status,
+		strings.Join(e.Expected, ", "))
+}
+
+func (e UnexpectedStatusCodeError) StatusCode() int {
+	return e.Status
+}
+
+// decodeAssertions builds Assertions from their JSON representation,
+// returning nil if asJSON is nil.
+func decodeAssertions(asJSON *AssertionsJSON) (*Assertions, error) {
+	if asJSON == nil {
+		return nil, nil
+	}
+
+	assertions := &Assertions{
+		StatusCodes:  asJSON.StatusCodes,
+		BodyContains: asJSON.BodyContains,
+		JSON:         asJSON.JSON,
+	}
+
+	for _, statusCodes := range asJSON.StatusCodes {
+		statusRange, err := parseStatusRange(statusCodes)
+		if err != nil {
+			return nil, err
+		}
+		assertions.statusRanges = append(assertions.statusRanges, statusRange)
+	}
+
+	var err error
+	if asJSON.BodyMatches != "" {
+		assertions.BodyMatches, err = regexp.Compile(asJSON.BodyMatches)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if asJSON.MaxLatency != "" {
+		assertions.MaxLatency, err = time.ParseDuration(asJSON.MaxLatency)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if asJSON.CertValidFor != "" {
+		assertions.CertValidFor, err = time.ParseDuration(asJSON.CertValidFor)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return assertions, nil
+}
+
+func parseStatusRange(statusCodes string) (statusRange, error) {
+	invalid := fmt.Errorf("Invalid status codes %q: must be a code, class or range, e.g. 200, 2xx or 200-299", statusCodes)
+
+	if len(statusCodes) == 3 && strings.HasSuffix(statusCodes, "xx") {
+		class, err := strconv.Atoi(statusCodes[:1])
+		if err != nil || class < 1 {
+			return statusRange{}, invalid
+		}
+		return statusRange{min: class * 100, max: class*100 + 99}, nil
+	}
+
+	bounds := strings.SplitN(statusCodes, "-", 2)
+	min, err := strconv.Atoi(bounds[0])
+	if err != nil {
+		return statusRange{}, invalid
+	}
+
+	max := min
+	if len(bounds) == 2 {
+		max, err = strconv.Atoi(bounds[1])
+		if err != nil || max < min {
+			return statusRange{}, invalid
+		}
+	}
+
+	return statusRange{min: min, max: max}, nil
+}
+
+func (a *Assertions) AsJSON() *AssertionsJSON {
+	asJSON := &AssertionsJSON{
+		StatusCodes:  a.StatusCodes,
+		BodyContains: a.BodyContains,
+		JSON:         a.JSON,
+	}
+
+	if a.BodyMatches != nil {
+		asJSON.BodyMatches = a.BodyMatches.String()
+	}
+
+	if a.MaxLatency != 0 {
+		asJSON.MaxLatency = a.MaxLatency.String()
+	}
+
+	if a.CertValidFor != 0 {
+		asJSON.CertValidFor = a.CertValidFor.String()
+	}
+
+	return asJSON
+}
+
+// Check returns an error describing the first assertion which the response
+// does not meet, if any. The body of the response must already have been
+// read, and latency is the time taken to do so.
+func (a *Assertions) Check(resp *http.Response, body []byte, latency time.Duration) error {
+	if len(a.statusRanges) > 0 && !a.acceptableStatusCode(resp.StatusCode) {
+		return UnexpectedStatusCodeError{Status: resp.StatusCode, Expected: a.StatusCodes}
+	}
+
+	if a.MaxLatency != 0 && latency > a.MaxLatency {
+		return AssertionFailedError{
+			Assertion: "maxLatency",
+			Message:   fmt.Sprintf("took %s, expected at most %s", latency, a.MaxLatency),
+		}
+	}
+
+	if a.CertValidFor != 0 {
+		err := a.checkCertificate(resp)
+		if err != nil {
+			return err
+		}
+	}
+
+	if a.BodyContains != "" && !strings.Contains(string(body), a.BodyContains) {
+		return AssertionFailedError{
+			Assertion: "bodyContains",
+			Message:   fmt.Sprintf("body does not contain %q", a.BodyContains),
+		}
+	}
+
+	if a.BodyMatches != nil && !a.BodyMatches.Match(body) {
+		return AssertionFailedError{
+			Assertion: "bodyMatches",
+			Message:   fmt.Sprintf("body does not match %q", a.BodyMatches),
+		}
+	}
+
+	if len(a.JSON) > 0 {
+		return a.checkJSON(body)
+	}
+
+	return nil
+}
+
+func (a *Assertions) acceptableStatusCode(statusCode int) bool {
+	for _, statusRange := range a.statusRanges {
+		if statusCode >= statusRange.min && statusCode <= statusRange.max {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *Assertions) checkCertificate(resp *http.Response) error {
+	if resp.TLS == nil || len(resp.TLS.PeerCertificates) == 0 {
+		return AssertionFailedError{
+			Assertion: "certValidFor",
+			Message:   "response was not received over TLS",
+		}
+	}
+
+	notAfter := resp.TLS.PeerCertificates[0].NotAfter
+	if remaining := notAfter.Sub(time.Now()); remaining < a.CertValidFor {
+		return AssertionFailedError{
+			Assertion: "certValidFor",
+			Message: fmt.Sprintf(
+				"certificate expires at %s, expected to be valid for at least %s",
+				notAfter.Format(time.RFC3339),
+				a.CertValidFor),
+		}
+	}
+
+	return nil
+}
+
+func (a *Assertions) checkJSON(body []byte) error {
+	var document interface{}
+	err := json.Unmarshal(body, &document)
+	if err != nil {
+		return AssertionFailedError{
+			Assertion: "json",
+			Message:   fmt.Sprintf("body is not JSON: %v", err),
+		}
+	}
+
+	for path, expected := range a.JSON {
+		actual, ok := lookupJSONPath(document, path)
+		if !ok {
+			return AssertionFailedError{
+				Assertion: "json",
+				Message:   fmt.Sprintf("%s not found", path),
+			}
+		}
+
+		if !reflect.DeepEqual(actual, expected) {
+			actualJSON, _ := json.Marshal(actual)
+			expectedJSON, _ := json.Marshal(expected)
+			return AssertionFailedError{
+				Assertion: "json",
+				Message:   fmt.Sprintf("%s is %s, expected %s", path, actualJSON, expectedJSON),
+			}
+		}
+	}
+
+	return nil
+}
+
+// lookupJSONPath returns the value at the path within a decoded JSON document.
+// Paths are keys and array indices separated by dots, e.g. "items.0.name",
+// optionally prefixed by "$." and with indices in brackets, e.g.
+// "$.items[0].name".
+func lookupJSONPath(document interface{}, path string) (interface{}, bool) {
+	path = strings.TrimPrefix(path, "$")
+	path = strings.Replace(path, "[", ".", -1)
+	path = strings.Replace(path, "]", "", -1)
+	path = strings.TrimPrefix(path, ".")
+
+	if path == "" {
+		return document, true
+	}
+
+	value := document
+	for _, key := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			var ok bool
+			value, ok = v[key]
+			if !ok {
+				return nil, false
+			}
+
+		case []interface{}:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(v) {
+				return nil, false
+			}
+			value = v[index]
+
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
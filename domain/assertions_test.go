@@ -0,0 +1,127 @@
+package domain_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/prodda/prodda/domain"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+)
+
+var _ = Describe("Assertions", func() {
+	var (
+		testLogger *lagertest.TestLogger
+		server     *httptest.Server
+		statusCode int
+	)
+
+	BeforeEach(func() {
+		testLogger = lagertest.NewTestLogger("assertions test")
+		statusCode = http.StatusOK
+		server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			rw.WriteHeader(statusCode)
+			rw.Write([]byte(`{"status":"ok","checks":[{"name":"db","healthy":true,"latency":3}]}`))
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	execute := func(url, assertions string) error {
+		task, err := domain.DecodeTask([]byte(`{
+			"schedule": "@daily",
+			"type": "url-get",
+			"url": "`+url+`",
+			"assertions": `+assertions+`
+		}`), testLogger)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = task.Execute(context.Background())
+		return err
+	}
+
+	It("passes responses which meet every assertion", func() {
+		err := execute(server.URL, `{
+			"statusCodes": ["204", "2xx"],
+			"bodyContains": "\"ok\"",
+			"bodyMatches": "checks.*healthy",
+			"json": {"status": "ok", "$.checks[0].healthy": true, "checks.0.latency": 3},
+			"maxLatency": "1m"
+		}`)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("fails responses with unexpected status codes, retaining the status code", func() {
+		statusCode = http.StatusServiceUnavailable
+
+		err := execute(server.URL, `{"statusCodes": ["200-299", "404"]}`)
+		Expect(err).To(MatchError("Assertion statusCodes failed: got 503, expected 200-299, 404"))
+
+		Expect(err).To(BeAssignableToTypeOf(domain.UnexpectedStatusCodeError{}))
+		Expect(err.(domain.StatusCodeError).StatusCode()).To(Equal(http.StatusServiceUnavailable))
+	})
+
+	It("fails responses whose body does not match", func() {
+		Expect(execute(server.URL, `{"bodyContains": "degraded"}`)).To(MatchError(`Assertion bodyContains failed: body does not contain "degraded"`))
+		Expect(execute(server.URL, `{"bodyMatches": "^<html>"}`)).To(MatchError(`Assertion bodyMatches failed: body does not match "^<html>"`))
+	})
+
+	It("fails responses whose JSON does not match", func() {
+		Expect(execute(server.URL, `{"json": {"status": "degraded"}}`)).To(MatchError(`Assertion json failed: status is "ok", expected "degraded"`))
+		Expect(execute(server.URL, `{"json": {"checks[1].name": "cache"}}`)).To(MatchError("Assertion json failed: checks[1].name not found"))
+	})
+
+	It("fails responses which are too slow", func() {
+		err := execute(server.URL, `{"maxLatency": "1ns"}`)
+		Expect(err).To(BeAssignableToTypeOf(domain.AssertionFailedError{}))
+		Expect(err.(domain.AssertionFailedError).Assertion).To(Equal("maxLatency"))
+	})
+
+	Describe("TLS certificate validity", func() {
+		var (
+			tlsServer        *httptest.Server
+			defaultTransport http.RoundTripper
+		)
+
+		BeforeEach(func() {
+			tlsServer = httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+
+			defaultTransport = http.DefaultTransport
+			http.DefaultTransport = tlsServer.Client().Transport
+		})
+
+		AfterEach(func() {
+			http.DefaultTransport = defaultTransport
+			tlsServer.Close()
+		})
+
+		It("fails responses whose certificate expires within the window", func() {
+			Expect(execute(tlsServer.URL, `{"certValidFor": "720h"}`)).To(Succeed())
+
+			err := execute(tlsServer.URL, `{"certValidFor": "1000000h"}`)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(HavePrefix("Assertion certValidFor failed: certificate expires at"))
+		})
+
+		It("fails responses not received over TLS", func() {
+			err := execute(server.URL, `{"certValidFor": "720h"}`)
+			Expect(err).To(MatchError("Assertion certValidFor failed: response was not received over TLS"))
+		})
+	})
+
+	It("rejects invalid assertions", func() {
+		decode := func(assertions string) error {
+			_, err := domain.DecodeTask([]byte(`{"schedule":"@daily","type":"url-get","url":"http://localhost/","assertions":`+assertions+`}`), testLogger)
+			return err
+		}
+
+		Expect(decode(`{"statusCodes": ["ok"]}`)).To(MatchError(`Invalid status codes "ok": must be a code, class or range, e.g. 200, 2xx or 200-299`))
+		Expect(decode(`{"statusCodes": ["299-200"]}`)).To(HaveOccurred())
+		Expect(decode(`{"bodyMatches": "("}`)).To(HaveOccurred())
+		Expect(decode(`{"maxLatency": "soon"}`)).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,67 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// defaultEndpoint is the API endpoint of tasks which do not specify one,
+// e.g. the Travis API endpoint of travis tasks. It may be configured while
+// tasks are running.
+type defaultEndpoint struct {
+	mutex    sync.RWMutex
+	endpoint string
+}
+
+func newDefaultEndpoint(endpoint string) *defaultEndpoint {
+	return &defaultEndpoint{endpoint: endpoint}
+}
+
+// set changes the default endpoint, returning an error if it is not an http
+// or https URL.
+func (d *defaultEndpoint) set(endpoint string) error {
+	if endpoint == "" {
+		return errors.New("Endpoint must be provided")
+	}
+
+	err := validateEndpoint(endpoint)
+	if err != nil {
+		return err
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.endpoint = endpoint
+	return nil
+}
+
+// resolve returns the endpoint of a task, or the default endpoint if it is
+// empty, without any trailing slash.
+func (d *defaultEndpoint) resolve(endpoint string) string {
+	if endpoint == "" {
+		d.mutex.RLock()
+		endpoint = d.endpoint
+		d.mutex.RUnlock()
+	}
+
+	return strings.TrimSuffix(endpoint, "/")
+}
+
+// validateEndpoint returns an error if the endpoint is neither empty,
+// for the default endpoint, nor an http or https URL.
+func validateEndpoint(endpoint string) error {
+	if endpoint == "" {
+		return nil
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("Endpoint must be an http or https URL: %q", endpoint)
+	}
+
+	return nil
+}
@@ -0,0 +1,5 @@
+package domain
+
+// UnregisterTaskType exposes unregisterTaskType to tests, so that task types
+// they register can be removed again.
+var UnregisterTaskType = unregisterTaskType
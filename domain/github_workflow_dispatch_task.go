@@ -0,0 +1,185 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/prodda/prodda/client"
+	"github.com/pivotal-golang/lager"
+)
+
+const (
+	GitHubWorkflowDispatchTaskType = "github-workflow-dispatch"
+
+	// DefaultGitHubEndpoint is the GitHub API endpoint of GitHub tasks which
+	// do not specify one, unless configured via SetDefaultGitHubEndpoint.
+	DefaultGitHubEndpoint = "https://api.github.com"
+)
+
+var gitHubEndpoint = newDefaultEndpoint(DefaultGitHubEndpoint)
+
+// GitHubWorkflowDispatchTask triggers a run of a GitHub Actions workflow,
+// as a TravisBuildTask triggers a Travis build.
+type GitHubWorkflowDispatchTask struct {
+	BaseTask
+	endpoint string
+	token    string
+	owner    string
+	repo     string
+	workflow string
+	ref      string
+	inputs   map[string]string
+}
+
+type GitHubWorkflowDispatchTaskJSON struct {
+	BaseTaskJson
+	Endpoint string            `json:"endpoint,omitempty"`
+	Owner    string            `json:"owner"`
+	Repo     string            `json:"repo"`
+	Workflow string            `json:"workflow"`
+	Ref      string            `json:"ref"`
+	Inputs   map[string]string `json:"inputs,omitempty"`
+}
+
+type gitHubWorkflowDispatchTaskRecord struct {
+	GitHubWorkflowDispatchTaskJSON
+	Token string `json:"token"`
+}
+
+func init() {
+	RegisterTaskType(TaskType{
+		Name:     GitHubWorkflowDispatchTaskType,
+		Decode:   decodeGitHubWorkflowDispatchTask,
+		Validate: validateGitHubWorkflowDispatchTask,
+		Encode:   encodeGitHubWorkflowDispatchTask,
+	})
+}
+
+// NewGitHubWorkflowDispatchTask returns a task which runs the workflow, given
+// by its file name, e.g. "nightly.yml", or ID, of the repository on ref, e.g.
+// "main", via the GitHub API at endpoint, or the default endpoint if it is
+// empty. inputs are optional.
+func NewGitHubWorkflowDispatchTask(
+	schedule string,
+	endpoint string,
+	token string,
+	owner string,
+	repo string,
+	workflow string,
+	ref string,
+	inputs map[string]string,
+	logger lager.Logger,
+) *GitHubWorkflowDispatchTask {
+	t := &GitHubWorkflowDispatchTask{
+		endpoint: endpoint,
+		token:    token,
+		owner:    owner,
+		repo:     repo,
+		workflow: workflow,
+		ref:      ref,
+		inputs:   inputs,
+	}
+
+	t.logger = logger
+	t.SetSchedule(schedule)
+
+	return t
+}
+
+func decodeGitHubWorkflowDispatchTask(b []byte, logger lager.Logger) (Task, error) {
+	var record gitHubWorkflowDispatchTaskRecord
+	err := json.Unmarshal(b, &record)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewGitHubWorkflowDispatchTask(
+		record.Schedule,
+		record.Endpoint,
+		record.Token,
+		record.Owner,
+		record.Repo,
+		record.Workflow,
+		record.Ref,
+		record.Inputs,
+		logger,
+	), nil
+}
+
+func validateGitHubWorkflowDispatchTask(task Task) error {
+	t := task.(*GitHubWorkflowDispatchTask)
+
+	if t.token == "" {
+		return errors.New("Token must be provided")
+	}
+
+	if t.owner == "" {
+		return errors.New("Owner must be provided")
+	}
+
+	if t.repo == "" {
+		return errors.New("Repo must be provided")
+	}
+
+	if t.workflow == "" {
+		return errors.New("Workflow must be provided")
+	}
+
+	if t.ref == "" {
+		return errors.New("Ref must be provided")
+	}
+
+	return validateEndpoint(t.endpoint)
+}
+
+func encodeGitHubWorkflowDispatchTask(task Task) ([]byte, error) {
+	t := task.(*GitHubWorkflowDispatchTask)
+
+	return json.Marshal(gitHubWorkflowDispatchTaskRecord{
+		GitHubWorkflowDispatchTaskJSON: t.AsJSON().(GitHubWorkflowDispatchTaskJSON),
+		Token:                          t.token,
+	})
+}
+
+func (t *GitHubWorkflowDispatchTask) Type() string {
+	return GitHubWorkflowDispatchTaskType
+}
+
+func (t *GitHubWorkflowDispatchTask) Execute(ctx context.Context) (Result, error) {
+	err := gitHubClient(t.endpoint).DispatchWorkflow(ctx, t.token, t.owner, t.repo, t.workflow, client.WorkflowDispatch{
+		Ref:    t.ref,
+		Inputs: t.inputs,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	t.logger.Info("Workflow dispatched", lager.Data{"task": t.AsJSON()})
+
+	return nil, nil
+}
+
+func (t *GitHubWorkflowDispatchTask) AsJSON() TaskJSON {
+	return GitHubWorkflowDispatchTaskJSON{
+		BaseTaskJson: t.baseJSON(t.Type()),
+		Endpoint:     t.endpoint,
+		Owner:        t.owner,
+		Repo:         t.repo,
+		Workflow:     t.workflow,
+		Ref:          t.ref,
+		Inputs:       t.inputs,
+	}
+}
+
+// SetDefaultGitHubEndpoint sets the GitHub API endpoint of GitHub tasks which
+// do not specify one, returning an error if it is not an http or https URL.
+func SetDefaultGitHubEndpoint(endpoint string) error {
+	return gitHubEndpoint.set(endpoint)
+}
+
+// gitHubClient returns a client of the GitHub API at endpoint,
+// or at the default endpoint if it is empty.
+func gitHubClient(endpoint string) *client.GitHub {
+	return client.NewGitHubClient(gitHubEndpoint.resolve(endpoint))
+}
@@ -0,0 +1,96 @@
+package domain_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/prodda/prodda/domain"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+)
+
+var _ = Describe("GitHub workflow dispatch task", func() {
+	var (
+		testLogger *lagertest.TestLogger
+		server     *httptest.Server
+		paths      chan string
+	)
+
+	BeforeEach(func() {
+		testLogger = lagertest.NewTestLogger("github workflow dispatch task test")
+
+		received := make(chan string, 1)
+		paths = received
+		server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			received <- r.URL.Path
+			rw.WriteHeader(http.StatusNoContent)
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("dispatches the workflow via the endpoint of the task", func() {
+		task := domain.NewGitHubWorkflowDispatchTask("@daily", server.URL+"/", "some-token", "prodda", "prodda", "nightly.yml", "main", nil, testLogger)
+
+		_, err := task.Execute(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(paths).To(Receive(Equal("/repos/prodda/prodda/actions/workflows/nightly.yml/dispatches")))
+	})
+
+	It("uses the default endpoint for tasks which do not specify one", func() {
+		err := domain.SetDefaultGitHubEndpoint(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+		defer domain.SetDefaultGitHubEndpoint(domain.DefaultGitHubEndpoint)
+
+		task := domain.NewGitHubWorkflowDispatchTask("@daily", "", "some-token", "prodda", "prodda", "1234", "v1.0.0", nil, testLogger)
+
+		_, err = task.Execute(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(paths).To(Receive(Equal("/repos/prodda/prodda/actions/workflows/1234/dispatches")))
+	})
+
+	It("omits the token from its JSON representation, but retains it when encoded", func() {
+		task, err := domain.DecodeTask([]byte(`{
+			"schedule": "@daily",
+			"type": "github-workflow-dispatch",
+			"token": "some-token",
+			"owner": "prodda",
+			"repo": "prodda",
+			"workflow": "nightly.yml",
+			"ref": "main",
+			"inputs": {"environment": "production"}
+		}`), testLogger)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(task.AsJSON().(domain.GitHubWorkflowDispatchTaskJSON).Inputs).To(Equal(map[string]string{"environment": "production"}))
+
+		asJSON, err := json.Marshal(task.AsJSON())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(asJSON)).NotTo(ContainSubstring("some-token"))
+
+		encoded, err := domain.EncodeTask(task)
+		Expect(err).NotTo(HaveOccurred())
+
+		decoded, err := domain.DecodeTask(encoded, testLogger)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(domain.EncodeTask(decoded)).To(MatchJSON(encoded))
+	})
+
+	It("validates its attributes", func() {
+		decode := func(fields string) error {
+			_, err := domain.DecodeTask([]byte(`{"schedule":"@daily","type":"github-workflow-dispatch",`+fields+`}`), testLogger)
+			return err
+		}
+
+		Expect(decode(`"owner":"prodda"`)).To(MatchError("Token must be provided"))
+		Expect(decode(`"token":"some-token"`)).To(MatchError("Owner must be provided"))
+		Expect(decode(`"token":"some-token","owner":"prodda"`)).To(MatchError("Repo must be provided"))
+		Expect(decode(`"token":"some-token","owner":"prodda","repo":"prodda"`)).To(MatchError("Workflow must be provided"))
+		Expect(decode(`"token":"some-token","owner":"prodda","repo":"prodda","workflow":"nightly.yml"`)).To(MatchError("Ref must be provided"))
+		Expect(decode(`"token":"some-token","owner":"prodda","repo":"prodda","workflow":"nightly.yml","ref":"main","endpoint":"github.example.com"`)).To(MatchError(`Endpoint must be an http or https URL: "github.example.com"`))
+	})
+})
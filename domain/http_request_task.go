@@ -0,0 +1,426 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pivotal-golang/lager"
+)
+
+const (
+	HTTPRequestTaskType = "http-request"
+
+	HTTPAuthBasic  = "basic"
+	HTTPAuthBearer = "bearer"
+
+	// redacted replaces secrets in the JSON representation of tasks.
+	redacted = "REDACTED"
+
+	// Parts of an HTTPRequestTask which may be listed in its redact field.
+	HTTPRedactPath = "path"
+	HTTPRedactBody = "body"
+)
+
+// sensitiveNames are the substrings which mark a header or query parameter
+// as carrying a secret, matched case-insensitively.
+var sensitiveNames = []string{
+	"authorization",
+	"cookie",
+	"token",
+	"secret",
+	"password",
+	"key",
+	"signature",
+}
+
+// HTTPRequestTask performs an arbitrary HTTP request. Like a URLGetTask,
+// it logs the response, and fails if the response has a 5xx status code or
+// does not meet its assertions.
+type HTTPRequestTask struct {
+	BaseTask
+	url        string
+	method     string
+	headers    map[string]string
+	query      map[string]string
+	body       string
+	auth       *HTTPAuth
+	assertions *Assertions
+	redact     []string
+}
+
+// HTTPAuth holds the credentials with which an HTTPRequestTask authenticates,
+// via either HTTP basic auth or a bearer token.
+type HTTPAuth struct {
+	Type     string `json:"type"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Token    string `json:"token,omitempty"`
+}
+
+// HTTPRequestTaskJSON redacts the values of sensitive headers and query
+// parameters, including those in the URL, omits any username and password
+// in the URL and the password or token of the auth, and redacts the path of
+// the URL and the body if they are listed in Redact.
+type HTTPRequestTaskJSON struct {
+	BaseTaskJson
+	URL     string            `json:"url"`
+	Method  string            `json:"method"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Query   map[string]string `json:"query,omitempty"`
+	Body    string            `json:"body,omitempty"`
+	Auth    *HTTPAuth         `json:"auth,omitempty"`
+	Redact  []string          `json:"redact,omitempty"`
+
+	Assertions *AssertionsJSON `json:"assertions,omitempty"`
+}
+
+type httpRequestTaskRecord struct {
+	HTTPRequestTaskJSON
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Query   map[string]string `json:"query,omitempty"`
+	Body    string            `json:"body,omitempty"`
+	Auth    *HTTPAuth         `json:"auth,omitempty"`
+}
+
+func init() {
+	RegisterTaskType(TaskType{
+		Name:     HTTPRequestTaskType,
+		Decode:   decodeHTTPRequestTask,
+		Validate: validateHTTPRequestTask,
+		Encode:   encodeHTTPRequestTask,
+	})
+}
+
+// NewHTTPRequestTask returns a task which performs a request with the given
+// method, or GET if it is empty. headers, query, auth and assertions may
+// be nil.
+func NewHTTPRequestTask(
+	schedule string,
+	url string,
+	method string,
+	headers map[string]string,
+	query map[string]string,
+	body string,
+	auth *HTTPAuth,
+	assertions *Assertions,
+	logger lager.Logger,
+) *HTTPRequestTask {
+	if method == "" {
+		method = "GET"
+	}
+
+	t := &HTTPRequestTask{
+		url:        url,
+		method:     strings.ToUpper(method),
+		headers:    headers,
+		query:      query,
+		body:       body,
+		auth:       auth,
+		assertions: assertions,
+	}
+
+	t.logger = logger
+	t.SetSchedule(schedule)
+
+	return t
+}
+
+func decodeHTTPRequestTask(b []byte, logger lager.Logger) (Task, error) {
+	var record httpRequestTaskRecord
+	err := json.Unmarshal(b, &record)
+	if err != nil {
+		return nil, err
+	}
+
+	assertions, err := decodeAssertions(record.Assertions)
+	if err != nil {
+		return nil, err
+	}
+
+	t := NewHTTPRequestTask(
+		record.Schedule,
+		record.URL,
+		record.Method,
+		record.Headers,
+		record.Query,
+		record.Body,
+		record.Auth,
+		assertions,
+		logger,
+	)
+	t.SetRedact(record.Redact)
+
+	return t, nil
+}
+
+func validateHTTPRequestTask(task Task) error {
+	t := task.(*HTTPRequestTask)
+
+	if t.url == "" {
+		return errors.New("URL must be provided")
+	}
+
+	u, err := url.Parse(t.url)
+	if err != nil {
+		return t.redactError(err)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.New("URL must be an http or https URL")
+	}
+
+	err = rejectRedacted(t, u)
+	if err != nil {
+		return err
+	}
+
+	if strings.ContainsAny(t.method, " \t\r\n") {
+		return errors.New("Method must be a valid HTTP method")
+	}
+
+	if t.auth != nil {
+		switch t.auth.Type {
+		case HTTPAuthBasic:
+			if t.auth.Username == "" {
+				return errors.New("Username must be provided for basic auth")
+			}
+		case HTTPAuthBearer:
+			if t.auth.Token == "" {
+				return errors.New("Token must be provided for bearer auth")
+			}
+		default:
+			return errors.New("Auth type must be one of basic, bearer")
+		}
+	}
+
+	for _, part := range t.redact {
+		if part != HTTPRedactPath && part != HTTPRedactBody {
+			return errors.New("Redact must only contain path, body")
+		}
+	}
+
+	return nil
+}
+
+// rejectRedacted returns an error if any secret of the task is the
+// placeholder which replaces it in the JSON representation, e.g. because the
+// task was retrieved from the API and sent back to update it, so that the
+// placeholder is never stored in place of the secret.
+func rejectRedacted(t *HTTPRequestTask, u *url.URL) error {
+	if t.redacts(HTTPRedactPath) && u.Path == "/"+redacted {
+		return fmt.Errorf("URL path must be provided in full, not as %s", redacted)
+	}
+
+	for name, values := range u.Query() {
+		for _, value := range values {
+			if value == redacted {
+				return fmt.Errorf("URL query parameter %s must be provided in full, not as %s", name, redacted)
+			}
+		}
+	}
+
+	for name, value := range t.headers {
+		if value == redacted {
+			return fmt.Errorf("Header %s must be provided in full, not as %s", name, redacted)
+		}
+	}
+
+	for name, value := range t.query {
+		if value == redacted {
+			return fmt.Errorf("Query parameter %s must be provided in full, not as %s", name, redacted)
+		}
+	}
+
+	if t.redacts(HTTPRedactBody) && t.body == redacted {
+		return fmt.Errorf("Body must be provided in full, not as %s", redacted)
+	}
+
+	return nil
+}
+
+func encodeHTTPRequestTask(task Task) ([]byte, error) {
+	t := task.(*HTTPRequestTask)
+
+	return json.Marshal(httpRequestTaskRecord{
+		HTTPRequestTaskJSON: t.AsJSON().(HTTPRequestTaskJSON),
+		URL:                 t.url,
+		Headers:             t.headers,
+		Query:               t.query,
+		Body:                t.body,
+		Auth:                t.auth,
+	})
+}
+
+// SetRedact determines which of the path of the URL and the body, e.g.
+// HTTPRedactPath for a webhook URL whose path is a secret, are redacted from
+// the JSON representation of the task, and so from the API and logs.
+func (t *HTTPRequestTask) SetRedact(redact []string) {
+	t.redact = redact
+}
+
+func (t *HTTPRequestTask) redacts(part string) bool {
+	for _, redacted := range t.redact {
+		if redacted == part {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *HTTPRequestTask) Type() string {
+	return HTTPRequestTaskType
+}
+
+func (t *HTTPRequestTask) Execute(ctx context.Context) (Result, error) {
+	requestURL, err := t.requestURL(t.query)
+	if err != nil {
+		return nil, t.redactError(err)
+	}
+
+	var body io.Reader
+	if t.body != "" {
+		body = strings.NewReader(t.body)
+	}
+
+	req, err := http.NewRequest(t.method, requestURL, body)
+	if err != nil {
+		return nil, t.redactError(err)
+	}
+
+	for name, value := range t.headers {
+		if http.CanonicalHeaderKey(name) == "Host" {
+			req.Host = value
+			continue
+		}
+		req.Header.Set(name, value)
+	}
+
+	if t.auth != nil {
+		switch t.auth.Type {
+		case HTTPAuthBasic:
+			req.SetBasicAuth(t.auth.Username, t.auth.Password)
+		case HTTPAuthBearer:
+			req.Header.Set("Authorization", "Bearer "+t.auth.Token)
+		}
+	}
+
+	result, err := executeRequest(ctx, req, t.assertions, t, t.logger)
+	return result, t.redactError(err)
+}
+
+// redactError redacts the URL of a *url.Error, e.g. from parsing the URL or
+// making the request, which may hold secrets like that of the task.
+func (t *HTTPRequestTask) redactError(err error) error {
+	if urlErr, ok := err.(*url.Error); ok {
+		urlErr.URL = redactURL(urlErr.URL, t.redacts(HTTPRedactPath))
+	}
+	return err
+}
+
+// requestURL returns the URL of the task with the query parameters added.
+func (t *HTTPRequestTask) requestURL(query map[string]string) (string, error) {
+	u, err := url.Parse(t.url)
+	if err != nil {
+		return "", err
+	}
+
+	values := u.Query()
+	for name, value := range query {
+		values.Set(name, value)
+	}
+	u.RawQuery = values.Encode()
+
+	return u.String(), nil
+}
+
+func (t *HTTPRequestTask) AsJSON() TaskJSON {
+	asJson := HTTPRequestTaskJSON{
+		BaseTaskJson: t.baseJSON(t.Type()),
+		URL:          redactURL(t.url, t.redacts(HTTPRedactPath)),
+		Method:       t.method,
+		Headers:      redactSensitive(t.headers),
+		Query:        redactSensitive(t.query),
+		Body:         t.body,
+		Redact:       t.redact,
+	}
+
+	if t.body != "" && t.redacts(HTTPRedactBody) {
+		asJson.Body = redacted
+	}
+
+	if t.assertions != nil {
+		asJson.Assertions = t.assertions.AsJSON()
+	}
+
+	if t.auth != nil {
+		asJson.Auth = &HTTPAuth{
+			Type:     t.auth.Type,
+			Username: t.auth.Username,
+		}
+	}
+
+	return asJson
+}
+
+// redactSensitive returns a copy of values in which the values of sensitive
+// names, e.g. "X-Api-Key", are redacted.
+func redactSensitive(values map[string]string) map[string]string {
+	if values == nil {
+		return nil
+	}
+
+	copied := map[string]string{}
+	for name, value := range values {
+		if sensitiveName(name) {
+			value = redacted
+		}
+		copied[name] = value
+	}
+	return copied
+}
+
+// redactURL returns the URL without any username and password, with the
+// values of sensitive query parameters redacted and, if redactPath, with its
+// path redacted.
+func redactURL(rawURL string, redactPath bool) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return redacted
+	}
+
+	u.User = nil
+
+	if redactPath && u.Path != "" && u.Path != "/" {
+		u.Path = "/" + redacted
+		u.RawPath = ""
+	}
+
+	if u.RawQuery != "" {
+		values := u.Query()
+		for name := range values {
+			if sensitiveName(name) {
+				values[name] = []string{redacted}
+			}
+		}
+		u.RawQuery = values.Encode()
+	}
+
+	return u.String()
+}
+
+func sensitiveName(name string) bool {
+	lower := strings.ToLower(name)
+	for _, sensitive := range sensitiveNames {
+		if strings.Contains(lower, sensitive) {
+			return true
+		}
+	}
+	return false
+}
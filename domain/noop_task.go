@@ -1,6 +1,8 @@
 package domain
 
 import (
+	"context"
+	"encoding/json"
 	"time"
 
 	"github.com/pivotal-golang/lager"
@@ -20,6 +22,15 @@ type NoOpTaskJSON struct {
 	SleepDuration string `json:"sleepDuration"`
 }
 
+func init() {
+	RegisterTaskType(TaskType{
+		Name:     NoOpTaskType,
+		Decode:   decodeNoOpTask,
+		Validate: validateNoOpTask,
+		Encode:   encodeNoOpTask,
+	})
+}
+
 func NewNoOpTask(schedule string, sleepDuration time.Duration, logger lager.Logger) *NoOpTask {
 	t := &NoOpTask{
 		sleepDuration: sleepDuration,
@@ -31,23 +42,48 @@ func NewNoOpTask(schedule string, sleepDuration time.Duration, logger lager.Logg
 	return t
 }
 
-func (t NoOpTask) Run() {
-	t.logger.Info("Task started", lager.Data{"task": t.AsJSON()})
-	time.Sleep(t.sleepDuration)
+func decodeNoOpTask(b []byte, logger lager.Logger) (Task, error) {
+	var record NoOpTaskJSON
+	err := json.Unmarshal(b, &record)
+	if err != nil {
+		return nil, err
+	}
+
+	var sleepDuration time.Duration
+	if record.SleepDuration != "" {
+		sleepDuration, err = time.ParseDuration(record.SleepDuration)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	t.logger.Info("Task completed", lager.Data{"task": t.AsJSON()})
-	return
+	return NewNoOpTask(record.Schedule, sleepDuration, logger), nil
 }
 
-func (t NoOpTask) AsJSON() TaskJSON {
-	asJson := NoOpTaskJSON{
-		SleepDuration: t.sleepDuration.String(),
-	}
+func validateNoOpTask(task Task) error {
+	return nil
+}
 
-	asJson.Type = NoOpTaskType
-	asJson.ID = t.ID()
-	asJson.Schedule = t.Schedule()
-	asJson.EntryID = t.EntryID()
+func encodeNoOpTask(task Task) ([]byte, error) {
+	return json.Marshal(task.AsJSON())
+}
+
+func (t *NoOpTask) Type() string {
+	return NoOpTaskType
+}
+
+func (t *NoOpTask) Execute(ctx context.Context) (Result, error) {
+	select {
+	case <-time.After(t.sleepDuration):
+		return nil, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
 
-	return asJson
+func (t *NoOpTask) AsJSON() TaskJSON {
+	return NoOpTaskJSON{
+		BaseTaskJson:  t.baseJSON(t.Type()),
+		SleepDuration: t.sleepDuration.String(),
+	}
 }
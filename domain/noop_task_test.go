@@ -1,12 +1,12 @@
 package domain_test
 
 import (
+	"context"
 	"time"
 
 	"github.com/prodda/prodda/domain"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
-	. "github.com/onsi/gomega/gbytes"
 	"github.com/pivotal-golang/lager/lagertest"
 )
 
@@ -18,15 +18,24 @@ var _ = Describe("No-op task", func() {
 		testLogger = lagertest.NewTestLogger("no-op task test")
 	})
 
-	It("logs and sleeps", func() {
+	It("sleeps and succeeds", func() {
 		sleepDuration := 50 * time.Millisecond
 		task := domain.NewNoOpTask(schedule, sleepDuration, testLogger)
 
 		startTime := time.Now()
-		task.Run()
+		_, err := task.Execute(context.Background())
 		duration := time.Now().Sub(startTime)
+		Expect(err).NotTo(HaveOccurred())
 		Expect(duration).To(BeNumerically(">=", sleepDuration))
-		Expect(testLogger.Buffer()).To(Say("started"))
-		Expect(testLogger.Buffer()).To(Say("completed"))
+	})
+
+	It("stops sleeping when cancelled", func() {
+		task := domain.NewNoOpTask(schedule, time.Hour, testLogger)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		_, err := task.Execute(ctx)
+		Expect(err).To(Equal(context.DeadlineExceeded))
 	})
 })
@@ -0,0 +1,248 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strings"
+	"time"
+)
+
+// Classes of failure which may be retried, as listed in RetryPolicy.RetryOn.
+const (
+	// RetryOnNetwork retries failures to communicate with a remote server,
+	// e.g. refused connections or failed DNS lookups.
+	RetryOnNetwork = "network"
+
+	// RetryOnTimeout retries attempts which exceed the timeout of the task.
+	RetryOnTimeout = "timeout"
+
+	// RetryOnServerError retries failures caused by a response with a 5xx
+	// status code; see StatusCodeError.
+	RetryOnServerError = "5xx"
+
+	// RetryOnAny retries every failure.
+	RetryOnAny = "any"
+)
+
+var (
+	retryClasses = []string{
+		RetryOnNetwork,
+		RetryOnTimeout,
+		RetryOnServerError,
+		RetryOnAny,
+	}
+
+	defaultRetryOn = []string{RetryOnNetwork, RetryOnServerError}
+)
+
+const (
+	defaultInitialBackoff = time.Second
+	defaultMultiplier     = 2.0
+
+	// maxRetryBackoff bounds every delay before jitter, whatever MaxBackoff,
+	// so that exponential growth cannot overflow a time.Duration.
+	maxRetryBackoff = 24 * time.Hour
+)
+
+// StatusCodeError is implemented by errors caused by the status code of an
+// HTTP response, so that they can be classified for retries.
+type StatusCodeError interface {
+	error
+	StatusCode() int
+}
+
+// ServerErrorStatusCodeError fails attempts which receive a response with a
+// 5xx status code, unless the statusCodes assertion of the task accepts it.
+type ServerErrorStatusCodeError struct {
+	Status int
+}
+
+func (e ServerErrorStatusCodeError) Error() string {
+	return fmt.Sprintf("Received server error status code: %d", e.Status)
+}
+
+func (e ServerErrorStatusCodeError) StatusCode() int {
+	return e.Status
+}
+
+// RetryPolicy determines whether, and when, failed executions of a task are
+// attempted again.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of executions per run, including
+	// the first.
+	MaxAttempts int
+
+	// InitialBackoff is the delay before the second attempt. Each subsequent
+	// delay is Multiplier times the previous one, up to MaxBackoff if it is
+	// not zero.
+	InitialBackoff time.Duration
+	Multiplier     float64
+	MaxBackoff     time.Duration
+
+	// Jitter randomly varies each delay by up to this fraction of it,
+	// e.g. 0.1 for up to 10% either way.
+	Jitter float64
+
+	// RetryOn lists the classes of failure which are retried, e.g.
+	// RetryOnNetwork.
+	RetryOn []string
+}
+
+type RetryPolicyJSON struct {
+	MaxAttempts    int      `json:"maxAttempts"`
+	InitialBackoff string   `json:"initialBackoff,omitempty"`
+	Multiplier     float64  `json:"multiplier,omitempty"`
+	MaxBackoff     string   `json:"maxBackoff,omitempty"`
+	Jitter         float64  `json:"jitter,omitempty"`
+	RetryOn        []string `json:"retryOn,omitempty"`
+}
+
+// decodeRetryPolicy builds and validates a RetryPolicy, applying defaults
+// for any omitted attributes other than MaxAttempts.
+func decodeRetryPolicy(asJSON RetryPolicyJSON) (*RetryPolicy, error) {
+	policy := &RetryPolicy{
+		MaxAttempts:    asJSON.MaxAttempts,
+		InitialBackoff: defaultInitialBackoff,
+		Multiplier:     defaultMultiplier,
+		Jitter:         asJSON.Jitter,
+		RetryOn:        defaultRetryOn,
+	}
+
+	var err error
+	if asJSON.InitialBackoff != "" {
+		policy.InitialBackoff, err = time.ParseDuration(asJSON.InitialBackoff)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if asJSON.MaxBackoff != "" {
+		policy.MaxBackoff, err = time.ParseDuration(asJSON.MaxBackoff)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if asJSON.Multiplier != 0 {
+		policy.Multiplier = asJSON.Multiplier
+	}
+
+	if asJSON.RetryOn != nil {
+		policy.RetryOn = asJSON.RetryOn
+	}
+
+	if policy.MaxAttempts < 1 {
+		return nil, errors.New("Retry maxAttempts must be at least 1")
+	}
+
+	if policy.InitialBackoff < 0 || policy.MaxBackoff < 0 {
+		return nil, errors.New("Retry backoff must not be negative")
+	}
+
+	if policy.Multiplier < 1 {
+		return nil, errors.New("Retry multiplier must be at least 1")
+	}
+
+	if policy.Jitter < 0 || policy.Jitter > 1 {
+		return nil, errors.New("Retry jitter must be between 0 and 1")
+	}
+
+	for _, class := range policy.RetryOn {
+		if !validRetryClass(class) {
+			return nil, fmt.Errorf(
+				"Retry retryOn must only contain %s",
+				strings.Join(retryClasses, ", "))
+		}
+	}
+
+	return policy, nil
+}
+
+func validRetryClass(class string) bool {
+	for _, valid := range retryClasses {
+		if class == valid {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *RetryPolicy) AsJSON() RetryPolicyJSON {
+	asJSON := RetryPolicyJSON{
+		MaxAttempts:    p.MaxAttempts,
+		InitialBackoff: p.InitialBackoff.String(),
+		Multiplier:     p.Multiplier,
+		Jitter:         p.Jitter,
+		RetryOn:        p.RetryOn,
+	}
+
+	if p.MaxBackoff != 0 {
+		asJSON.MaxBackoff = p.MaxBackoff.String()
+	}
+
+	return asJSON
+}
+
+// Backoff returns the delay before the given attempt, which must be at least
+// 2, never more than 24 hours before jitter. random must be in [0, 1), and
+// determines the jitter applied.
+func (p *RetryPolicy) Backoff(attempt int, random float64) time.Duration {
+	backoff := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(attempt-2))
+	if p.MaxBackoff != 0 && backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+	if backoff > float64(maxRetryBackoff) {
+		backoff = float64(maxRetryBackoff)
+	}
+
+	backoff *= 1 + p.Jitter*(2*random-1)
+	return time.Duration(backoff)
+}
+
+// Retryable returns whether a failed attempt, which returned err after
+// running with ctx, should be retried. Attempts cancelled other than by their
+// timeout, e.g. by shutdown, are never retried.
+func (p *RetryPolicy) Retryable(ctx context.Context, err error) bool {
+	class := failureClass(ctx, err)
+	if class == "" {
+		return false
+	}
+
+	for _, retryOn := range p.RetryOn {
+		if retryOn == RetryOnAny || retryOn == class {
+			return true
+		}
+	}
+	return false
+}
+
+// failureClass classifies a failed attempt, returning the empty string
+// for attempts which were cancelled.
+func failureClass(ctx context.Context, err error) string {
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		return RetryOnTimeout
+	case context.Canceled:
+		return ""
+	}
+
+	var outcomeErr OutcomeError
+	if errors.As(err, &outcomeErr) && outcomeErr.Outcome() == RunTimedOut {
+		return RetryOnTimeout
+	}
+
+	var statusCodeErr StatusCodeError
+	if errors.As(err, &statusCodeErr) && statusCodeErr.StatusCode() >= 500 {
+		return RetryOnServerError
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return RetryOnNetwork
+	}
+
+	return RetryOnAny
+}
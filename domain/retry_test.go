@@ -0,0 +1,94 @@
+package domain_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prodda/prodda/domain"
+)
+
+type statusCodeError int
+
+func (e statusCodeError) Error() string {
+	return fmt.Sprintf("Unexpected status code: %d", int(e))
+}
+
+func (e statusCodeError) StatusCode() int {
+	return int(e)
+}
+
+var _ = Describe("Retry policies", func() {
+	var policy *domain.RetryPolicy
+
+	BeforeEach(func() {
+		policy = &domain.RetryPolicy{
+			MaxAttempts:    5,
+			InitialBackoff: time.Second,
+			Multiplier:     3,
+			MaxBackoff:     10 * time.Second,
+			RetryOn:        []string{domain.RetryOnNetwork, domain.RetryOnServerError},
+		}
+	})
+
+	It("backs off exponentially up to the maximum backoff", func() {
+		Expect(policy.Backoff(2, 0.5)).To(Equal(time.Second))
+		Expect(policy.Backoff(3, 0.5)).To(Equal(3 * time.Second))
+		Expect(policy.Backoff(4, 0.5)).To(Equal(9 * time.Second))
+		Expect(policy.Backoff(5, 0.5)).To(Equal(10 * time.Second))
+	})
+
+	It("backs off at most 24 hours, however many attempts are made", func() {
+		policy.MaxBackoff = 0
+
+		Expect(policy.Backoff(30, 0.5)).To(Equal(24 * time.Hour))
+		Expect(policy.Backoff(1000, 0.5)).To(Equal(24 * time.Hour))
+
+		policy.Jitter = 1
+		Expect(policy.Backoff(1000, 0.75)).To(Equal(36 * time.Hour))
+	})
+
+	It("applies jitter to the backoff", func() {
+		policy.Jitter = 0.1
+
+		Expect(policy.Backoff(2, 0)).To(Equal(900 * time.Millisecond))
+		Expect(policy.Backoff(2, 0.5)).To(Equal(time.Second))
+		Expect(policy.Backoff(2, 0.75)).To(Equal(1050 * time.Millisecond))
+	})
+
+	It("retries only the configured classes of failure", func() {
+		ctx := context.Background()
+		networkErr := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+		Expect(policy.Retryable(ctx, networkErr)).To(BeTrue())
+		Expect(policy.Retryable(ctx, fmt.Errorf("Failed: %w", statusCodeError(503)))).To(BeTrue())
+		Expect(policy.Retryable(ctx, statusCodeError(404))).To(BeFalse())
+		Expect(policy.Retryable(ctx, errors.New("some error"))).To(BeFalse())
+
+		policy.RetryOn = []string{domain.RetryOnAny}
+		Expect(policy.Retryable(ctx, errors.New("some error"))).To(BeTrue())
+	})
+
+	It("retries timed out attempts only if configured to", func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 0)
+		defer cancel()
+		<-ctx.Done()
+
+		Expect(policy.Retryable(ctx, ctx.Err())).To(BeFalse())
+
+		policy.RetryOn = []string{domain.RetryOnTimeout}
+		Expect(policy.Retryable(ctx, ctx.Err())).To(BeTrue())
+	})
+
+	It("never retries cancelled attempts", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		policy.RetryOn = []string{domain.RetryOnAny}
+		Expect(policy.Retryable(ctx, ctx.Err())).To(BeFalse())
+	})
+})
@@ -0,0 +1,82 @@
+package domain
+
+import "time"
+
+const (
+	RunSucceeded = "succeeded"
+	RunFailed    = "failed"
+
+	// RunSkipped and RunReplaced record runs prevented, or cut short,
+	// by the concurrency policy of the task.
+	RunSkipped  = "skipped"
+	RunReplaced = "replaced"
+
+	// RunTimedOut records runs cut short by the timeout of the task, and
+	// RunCancelled those cut short by shutdown.
+	RunTimedOut  = "timedOut"
+	RunCancelled = "cancelled"
+
+	// RunErrored records runs which failed because of an error in the
+	// environment of the target rather than the target itself, e.g. a Travis
+	// build which errored.
+	RunErrored = "errored"
+)
+
+// OutcomeError is implemented by errors which determine the outcome of the
+// failed run which returned them, e.g. RunErrored.
+type OutcomeError interface {
+	error
+	Outcome() string
+}
+
+// Result holds type-specific details of an execution of a task,
+// e.g. the status code of a response.
+type Result map[string]interface{}
+
+// Run records a single execution of a task.
+type Run struct {
+	TaskID uint
+
+	// Attempt numbers the executions made for a single run of a task, from 1,
+	// when failed executions are retried; see RetryPolicy.
+	Attempt int
+
+	StartTime time.Time
+	EndTime   time.Time
+	Outcome   string
+	Error     string
+	Result    Result
+}
+
+type RunJSON struct {
+	TaskID    uint      `json:"taskID"`
+	Attempt   int       `json:"attempt,omitempty"`
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime"`
+	Duration  string    `json:"duration"`
+	Outcome   string    `json:"outcome"`
+	Error     string    `json:"error,omitempty"`
+	Result    Result    `json:"result,omitempty"`
+}
+
+func (r Run) Duration() time.Duration {
+	return r.EndTime.Sub(r.StartTime)
+}
+
+func (r Run) AsJSON() RunJSON {
+	return RunJSON{
+		TaskID:    r.TaskID,
+		Attempt:   r.Attempt,
+		StartTime: r.StartTime,
+		EndTime:   r.EndTime,
+		Duration:  r.Duration().String(),
+		Outcome:   r.Outcome,
+		Error:     r.Error,
+		Result:    r.Result,
+	}
+}
+
+// RunRecorder is notified of every completed run of a task.
+type RunRecorder interface {
+	RecordRun(run Run) error
+}
@@ -0,0 +1,253 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gopkg.in/robfig/cron.v2"
+)
+
+// InvalidScheduleError is returned when a schedule cannot be parsed
+// as a cron spec.
+type InvalidScheduleError struct {
+	Schedule string
+	Err      error
+}
+
+func (e InvalidScheduleError) Error() string {
+	return fmt.Sprintf("Invalid schedule %q: %v", e.Schedule, e.Err)
+}
+
+// InvalidTimezoneError is returned when a time zone is not a known
+// IANA time zone name.
+type InvalidTimezoneError struct {
+	Timezone string
+	Err      error
+}
+
+func (e InvalidTimezoneError) Error() string {
+	return fmt.Sprintf("Invalid timezone %q: %v", e.Timezone, e.Err)
+}
+
+// ScheduleTooFrequentError is returned when consecutive fire times of a
+// schedule can be closer together than the minimum interval.
+type ScheduleTooFrequentError struct {
+	Schedule string
+	Interval time.Duration
+	Minimum  time.Duration
+}
+
+func (e ScheduleTooFrequentError) Error() string {
+	return fmt.Sprintf(
+		"Schedule %q fires %s apart, more often than the minimum interval of %s",
+		e.Schedule,
+		e.Interval,
+		e.Minimum)
+}
+
+const (
+	// timezonePrefix introduces the time zone of a cron spec, e.g.
+	// "TZ=Europe/London 0 0 3 * * *".
+	timezonePrefix = "TZ="
+
+	// frequencyCheckHorizon bounds the fire times considered when checking the
+	// frequency of a schedule; it is long enough to include the transitions
+	// between every month of the year.
+	frequencyCheckHorizon = 366 * 24 * time.Hour
+
+	// maximumFrequencyCheckFireTimes bounds the fire times considered when
+	// checking the frequency of a schedule which fires often; the intervals of
+	// such schedules repeat well within this many fire times.
+	maximumFrequencyCheckFireTimes = 100000
+)
+
+// ParseSchedule parses the schedule using the same parser as the cron which
+// runs tasks, returning an InvalidScheduleError if it is not a valid cron spec.
+func ParseSchedule(schedule string) (cron.Schedule, error) {
+	parsed, err := cron.Parse(schedule)
+	if err != nil {
+		return nil, InvalidScheduleError{Schedule: schedule, Err: err}
+	}
+	return parsed, nil
+}
+
+// ValidateTimezone returns an InvalidTimezoneError if the time zone is not
+// a known IANA time zone name.
+func ValidateTimezone(timezone string) error {
+	_, err := LoadTimezone(timezone)
+	return err
+}
+
+// LoadTimezone returns the location with the given IANA time zone name,
+// or the local time zone if the name is empty.
+func LoadTimezone(timezone string) (*time.Location, error) {
+	if timezone == "" {
+		return time.Local, nil
+	}
+
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, InvalidTimezoneError{Timezone: timezone, Err: err}
+	}
+	return location, nil
+}
+
+// ScheduleInTimezone returns a cron spec which evaluates the schedule in the
+// named time zone. Schedules which already name a time zone via a TZ= prefix,
+// and all schedules if the name is empty, are returned unchanged.
+func ScheduleInTimezone(schedule, timezone string) string {
+	if timezone == "" || strings.HasPrefix(schedule, timezonePrefix) {
+		return schedule
+	}
+	return timezonePrefix + timezone + " " + schedule
+}
+
+// NextFireTimes returns up to n times at which the schedule is next activated
+// after the given time. Fewer are returned if the schedule cannot be satisfied.
+func NextFireTimes(schedule cron.Schedule, after time.Time, n int) []time.Time {
+	fireTimes := []time.Time{}
+	for t := schedule.Next(after); !t.IsZero() && len(fireTimes) < n; t = schedule.Next(t) {
+		fireTimes = append(fireTimes, t)
+	}
+	return fireTimes
+}
+
+// ValidateScheduleFrequency returns a ScheduleTooFrequentError if any two
+// consecutive fire times of the schedule, which must be parseable, are less
+// than the minimum interval apart. A minimum of zero permits all schedules.
+func ValidateScheduleFrequency(schedule string, minimum time.Duration) error {
+	if minimum <= 0 {
+		return nil
+	}
+
+	parsed, err := ParseSchedule(schedule)
+	if err != nil {
+		return err
+	}
+
+	tooFrequent := func(interval time.Duration) error {
+		return ScheduleTooFrequentError{
+			Schedule: schedule,
+			Interval: interval,
+			Minimum:  minimum,
+		}
+	}
+
+	if constantDelay, ok := parsed.(cron.ConstantDelaySchedule); ok {
+		if constantDelay.Delay < minimum {
+			return tooFrequent(constantDelay.Delay)
+		}
+		return nil
+	}
+
+	// The horizon is measured from the first fire time, rather than from now,
+	// so that schedules which first fire in over a year are still checked.
+	first := parsed.Next(time.Now())
+	prev := first
+	for i := 0; !prev.IsZero() && i < maximumFrequencyCheckFireTimes; i++ {
+		next := parsed.Next(prev)
+		if next.IsZero() || next.Sub(first) > frequencyCheckHorizon {
+			break
+		}
+
+		if interval := next.Sub(prev); interval < minimum {
+			return tooFrequent(interval)
+		}
+		prev = next
+	}
+	return nil
+}
+
+var (
+	monthNames = []string{"", "jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+	dowNames   = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+)
+
+// DescribeSchedule returns a human-readable description of a parsed schedule.
+func DescribeSchedule(schedule cron.Schedule) string {
+	switch s := schedule.(type) {
+	case cron.ConstantDelaySchedule:
+		return fmt.Sprintf("Every %s", s.Delay)
+
+	case *cron.SpecSchedule:
+		times := []string{
+			describeField(s.Second, 0, 59, "second", nil),
+			describeField(s.Minute, 0, 59, "minute", nil),
+			describeField(s.Hour, 0, 23, "hour", nil),
+		}
+
+		days := []string{}
+		if !allBitsSet(s.Dom, 1, 31) {
+			days = append(days, "on "+describeField(s.Dom, 1, 31, "day of the month", nil))
+		}
+		if !allBitsSet(s.Dow, 0, 6) {
+			days = append(days, "on "+describeValues(s.Dow, 0, 6, dowNames))
+		}
+		if !allBitsSet(s.Month, 1, 12) {
+			days = append(days, "in "+describeValues(s.Month, 1, 12, monthNames))
+		}
+		if len(days) == 0 {
+			days = append(days, "every day")
+		}
+
+		description := fmt.Sprintf("At %s; %s", strings.Join(times, ", "), strings.Join(days, ", "))
+		if s.Location != time.Local {
+			description += fmt.Sprintf(" (%s)", s.Location)
+		}
+		return description
+
+	default:
+		return fmt.Sprintf("%v", schedule)
+	}
+}
+
+func describeField(bits uint64, min, max uint, unit string, names []string) string {
+	if allBitsSet(bits, min, max) {
+		return "every " + unit
+	}
+	return unit + " " + describeValues(bits, min, max, names)
+}
+
+// describeValues lists the values whose bits are set, collapsing runs of
+// three or more consecutive values into ranges, e.g. "mon-fri".
+func describeValues(bits uint64, min, max uint, names []string) string {
+	name := func(value uint) string {
+		if names != nil {
+			return names[value]
+		}
+		return fmt.Sprint(value)
+	}
+
+	values := []string{}
+	for start := min; start <= max; start++ {
+		if bits&(1<<start) == 0 {
+			continue
+		}
+
+		end := start
+		for end < max && bits&(1<<(end+1)) != 0 {
+			end++
+		}
+
+		switch end - start {
+		case 0:
+			values = append(values, name(start))
+		case 1:
+			values = append(values, name(start), name(end))
+		default:
+			values = append(values, name(start)+"-"+name(end))
+		}
+		start = end
+	}
+	return strings.Join(values, ", ")
+}
+
+func allBitsSet(bits uint64, min, max uint) bool {
+	for value := min; value <= max; value++ {
+		if bits&(1<<value) == 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,81 @@
+package domain_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prodda/prodda/domain"
+)
+
+var _ = Describe("Schedules", func() {
+	It("returns an InvalidScheduleError for invalid schedules", func() {
+		_, err := domain.ParseSchedule("* * *")
+		Expect(err).To(BeAssignableToTypeOf(domain.InvalidScheduleError{}))
+		Expect(err.Error()).To(ContainSubstring("Expected 5 or 6 fields"))
+	})
+
+	It("describes schedules", func() {
+		descriptions := map[string]string{
+			"@daily":                       "At second 0, minute 0, hour 0; every day",
+			"@every 5m":                    "Every 5m0s",
+			"*/20 0,30 * * * *":            "At second 0, 20, 40, minute 0, 30, every hour; every day",
+			"0 0 12 1 jan-mar,dec *":       "At second 0, minute 0, hour 12; on day of the month 1, in jan-mar, dec",
+			"TZ=Europe/London 0 0 3 * * *": "At second 0, minute 0, hour 3; every day (Europe/London)",
+		}
+
+		for spec, description := range descriptions {
+			schedule, err := domain.ParseSchedule(spec)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(domain.DescribeSchedule(schedule)).To(Equal(description))
+		}
+	})
+
+	It("returns the next fire times of a schedule", func() {
+		schedule, err := domain.ParseSchedule("@every 1h")
+		Expect(err).NotTo(HaveOccurred())
+
+		now := time.Date(2015, 6, 1, 10, 0, 0, 0, time.UTC)
+		Expect(domain.NextFireTimes(schedule, now, 2)).To(Equal([]time.Time{
+			now.Add(time.Hour),
+			now.Add(2 * time.Hour),
+		}))
+	})
+
+	Describe("validating frequency", func() {
+		It("accepts schedules which fire no more often than the minimum interval", func() {
+			for _, spec := range []string{"@every 1m", "0 * * * * *", "@daily", "0 0 12 29 feb *"} {
+				Expect(domain.ValidateScheduleFrequency(spec, time.Minute)).To(Succeed())
+			}
+		})
+
+		It("rejects schedules which can fire more often than the minimum interval", func() {
+			err := domain.ValidateScheduleFrequency("@every 30s", time.Minute)
+			Expect(err).To(Equal(domain.ScheduleTooFrequentError{
+				Schedule: "@every 30s",
+				Interval: 30 * time.Second,
+				Minimum:  time.Minute,
+			}))
+
+			err = domain.ValidateScheduleFrequency("* * * * * ?", time.Minute)
+			Expect(err).To(BeAssignableToTypeOf(domain.ScheduleTooFrequentError{}))
+			Expect(err.(domain.ScheduleTooFrequentError).Interval).To(Equal(time.Second))
+		})
+
+		It("considers intervals which span hours and days", func() {
+			err := domain.ValidateScheduleFrequency("0 59,0 23,0 * * *", 5*time.Minute)
+			Expect(err).To(BeAssignableToTypeOf(domain.ScheduleTooFrequentError{}))
+			Expect(err.(domain.ScheduleTooFrequentError).Interval).To(Equal(time.Minute))
+		})
+
+		It("permits all schedules when the minimum interval is zero", func() {
+			Expect(domain.ValidateScheduleFrequency("* * * * * ?", 0)).To(Succeed())
+		})
+
+		It("checks schedules which first fire more than a year from now", func() {
+			err := domain.ValidateScheduleFrequency("* * * 29 2 ?", time.Minute)
+			Expect(err).To(BeAssignableToTypeOf(domain.ScheduleTooFrequentError{}))
+			Expect(err.(domain.ScheduleTooFrequentError).Interval).To(Equal(time.Second))
+		})
+	})
+})
@@ -1,7 +1,9 @@
 package domain
 
 import (
+	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/pivotal-golang/lager"
@@ -9,64 +11,271 @@ import (
 )
 
 const (
+	// MinimumTaskFrequency is the default minimum interval between consecutive
+	// scheduled runs of a task; see ValidateScheduleFrequency.
 	MinimumTaskFrequency = time.Duration(1 * time.Minute)
 )
 
+// Concurrency policies determine what happens when a task is due to run while
+// a previous run of it is still in progress.
+const (
+	// ConcurrencyAllow runs the task regardless. It is the default policy.
+	ConcurrencyAllow = "allow"
+
+	// ConcurrencySkip does not run the task, recording the run as skipped.
+	ConcurrencySkip = "skip"
+
+	// ConcurrencyQueue runs the task once the previous run has completed. At
+	// most one run is queued; further runs are skipped while one is queued.
+	ConcurrencyQueue = "queue"
+
+	// ConcurrencyReplace runs the task, and records the previous run as
+	// replaced rather than waiting for it.
+	ConcurrencyReplace = "replace"
+)
+
+var concurrencyPolicies = []string{
+	ConcurrencyAllow,
+	ConcurrencySkip,
+	ConcurrencyQueue,
+	ConcurrencyReplace,
+}
+
 type Task interface {
+	// Type returns the name of the registered TaskType of the task.
+	Type() string
+
 	ID() uint
+	// SetID assigns an ID to a task which has none. An ID of zero clears the
+	// ID, so that another may be assigned.
 	SetID(id uint) error
 
 	Schedule() string
 	SetSchedule(schedule string)
 
+	// Timezone returns the IANA name of the time zone in which the schedule
+	// is evaluated, or the empty string for the default time zone.
+	Timezone() string
+	SetTimezone(timezone string)
+
+	// Timeout returns the maximum duration of an execution of the task,
+	// or zero if executions are not limited.
+	Timeout() time.Duration
+	SetTimeout(timeout time.Duration)
+
+	// RetryPolicy returns the policy by which failed executions of the task
+	// are attempted again, or nil if they are not.
+	RetryPolicy() *RetryPolicy
+	SetRetryPolicy(policy *RetryPolicy)
+
 	EntryID() cron.EntryID
 	SetEntryID(id cron.EntryID)
 
-	Run()
+	// ConcurrencyPolicy returns the concurrency policy of the task,
+	// e.g. ConcurrencySkip.
+	ConcurrencyPolicy() string
+	SetConcurrencyPolicy(policy string)
+
+	// Paused returns whether the task is prevented from running on its
+	// schedule. Paused tasks remain in the registry and can still be run
+	// on demand.
+	Paused() bool
+	SetPaused(paused bool)
+
+	// Execute runs the task once, returning type-specific details of the
+	// execution, and an error if the execution failed. Execution should stop,
+	// returning an error, once ctx is done, e.g. because the timeout of the
+	// task has elapsed. Tasks are scheduled via an adapter which records and
+	// logs each execution, and applies the timeout; see schedule.Executor.
+	Execute(ctx context.Context) (Result, error)
 
 	AsJSON() TaskJSON
 }
 
+// BaseTask is safe for concurrent use, e.g. by the scheduler running a task
+// while it is being updated via the API. Tasks embedding it must only be used
+// via pointers.
 type BaseTask struct {
-	id       uint
-	schedule string
-	logger   lager.Logger
-	entryID  cron.EntryID
+	mutex             sync.RWMutex
+	id                uint
+	schedule          string
+	timezone          string
+	timeout           time.Duration
+	retryPolicy       *RetryPolicy
+	logger            lager.Logger
+	entryID           cron.EntryID
+	paused            bool
+	concurrencyPolicy string
 }
 
-func (t BaseTask) ID() uint {
+func (t *BaseTask) ID() uint {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
 	return t.id
 }
 
 func (t *BaseTask) SetID(id uint) error {
-	if t.id != 0 {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.id != 0 && id != 0 {
 		return fmt.Errorf("Task already has an ID: %d", t.id)
 	}
 	t.id = id
 	return nil
 }
 
-func (t BaseTask) Schedule() string {
+func (t *BaseTask) Schedule() string {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
 	return t.schedule
 }
 
 func (t *BaseTask) SetSchedule(schedule string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
 	t.schedule = schedule
 }
 
-func (t BaseTask) EntryID() cron.EntryID {
+func (t *BaseTask) Timezone() string {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	return t.timezone
+}
+
+func (t *BaseTask) SetTimezone(timezone string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.timezone = timezone
+}
+
+func (t *BaseTask) Timeout() time.Duration {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	return t.timeout
+}
+
+func (t *BaseTask) SetTimeout(timeout time.Duration) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.timeout = timeout
+}
+
+// timeoutString formats the timeout of a task for BaseTaskJson,
+// omitting it if executions are not limited.
+func (t *BaseTask) timeoutString() string {
+	timeout := t.Timeout()
+	if timeout == 0 {
+		return ""
+	}
+	return timeout.String()
+}
+
+func (t *BaseTask) RetryPolicy() *RetryPolicy {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	return t.retryPolicy
+}
+
+func (t *BaseTask) SetRetryPolicy(policy *RetryPolicy) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.retryPolicy = policy
+}
+
+// retryJSON formats the retry policy of a task for BaseTaskJson,
+// omitting it if failed executions are not retried.
+func (t *BaseTask) retryJSON() *RetryPolicyJSON {
+	policy := t.RetryPolicy()
+	if policy == nil {
+		return nil
+	}
+
+	asJSON := policy.AsJSON()
+	return &asJSON
+}
+
+// baseJSON returns the attributes common to tasks of every type, for the
+// JSON representation of a task of type taskType.
+func (t *BaseTask) baseJSON(taskType string) BaseTaskJson {
+	return BaseTaskJson{
+		ID:                t.ID(),
+		Schedule:          t.Schedule(),
+		Timezone:          t.Timezone(),
+		Timeout:           t.timeoutString(),
+		Retry:             t.retryJSON(),
+		EntryID:           t.EntryID(),
+		Type:              taskType,
+		Paused:            t.Paused(),
+		ConcurrencyPolicy: t.ConcurrencyPolicy(),
+	}
+}
+
+func (t *BaseTask) EntryID() cron.EntryID {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
 	return t.entryID
 }
 
 func (t *BaseTask) SetEntryID(entryID cron.EntryID) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
 	t.entryID = entryID
 }
 
+// ConcurrencyPolicy returns ConcurrencyAllow if no policy has been set.
+func (t *BaseTask) ConcurrencyPolicy() string {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	if t.concurrencyPolicy == "" {
+		return ConcurrencyAllow
+	}
+	return t.concurrencyPolicy
+}
+
+func (t *BaseTask) SetConcurrencyPolicy(policy string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.concurrencyPolicy = policy
+}
+
+func (t *BaseTask) Paused() bool {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	return t.paused
+}
+
+func (t *BaseTask) SetPaused(paused bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.paused = paused
+}
+
 type TaskJSON interface{}
 
 type BaseTaskJson struct {
-	ID       uint         `json:"id"`
-	Schedule string       `json:"schedule"`
-	EntryID  cron.EntryID `json:"entryID"`
-	Type     string       `json:"type"`
+	ID                uint             `json:"id"`
+	Schedule          string           `json:"schedule"`
+	Timezone          string           `json:"timezone,omitempty"`
+	Timeout           string           `json:"timeout,omitempty"`
+	Retry             *RetryPolicyJSON `json:"retry,omitempty"`
+	EntryID           cron.EntryID     `json:"entryID"`
+	Type              string           `json:"type"`
+	Paused            bool             `json:"paused"`
+	ConcurrencyPolicy string           `json:"concurrencyPolicy"`
 }
@@ -0,0 +1,37 @@
+package domain_test
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/prodda/prodda/domain"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+	"gopkg.in/robfig/cron.v2"
+)
+
+var _ = Describe("BaseTask", func() {
+	It("is safe for concurrent use", func() {
+		task := domain.NewURLGetTask("@daily", "http://localhost/", lagertest.NewTestLogger("task test"))
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(2)
+
+			go func(i int) {
+				defer wg.Done()
+				task.SetSchedule(fmt.Sprintf("@every %dm", i+1))
+				task.SetEntryID(cron.EntryID(i))
+			}(i)
+
+			go func() {
+				defer wg.Done()
+				task.AsJSON()
+			}()
+		}
+		wg.Wait()
+
+		Expect(task.Schedule()).To(HavePrefix("@every"))
+	})
+})
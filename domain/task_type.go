@@ -0,0 +1,309 @@
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pivotal-golang/lager"
+)
+
+// TaskType describes how tasks of a given type are built from, and serialized
+// to, JSON. Every type of task must be registered via RegisterTaskType so that
+// the API, registries and other tools all build tasks in the same way.
+type TaskType struct {
+	// Name identifies the type, and is the value of the "type" JSON field.
+	Name string
+
+	// Decode builds an unscheduled task, without an ID, from its JSON
+	// representation. It should return an error only if the JSON is malformed;
+	// validation of the resultant task is the responsibility of Validate.
+	Decode func(b []byte, logger lager.Logger) (Task, error)
+
+	// Validate returns an error describing the first invalid attribute of
+	// the task, if any. The task will have been built by Decode.
+	Validate func(task Task) error
+
+	// Encode serializes the task in full, including secrets omitted from AsJSON,
+	// such that passing the result to Decode builds an equivalent task.
+	Encode func(task Task) ([]byte, error)
+}
+
+// UnrecognizedTaskTypeError is returned when decoding a task whose type
+// has not been registered.
+type UnrecognizedTaskTypeError struct {
+	Type string
+}
+
+func (e UnrecognizedTaskTypeError) Error() string {
+	return fmt.Sprintf("Unrecognized task type: %s", e.Type)
+}
+
+// TaskTypeChangedError is returned when attempting to replace a task
+// with one of a different type.
+type TaskTypeChangedError struct {
+	Existing    string
+	Replacement string
+}
+
+func (e TaskTypeChangedError) Error() string {
+	return fmt.Sprintf("Task type cannot be changed from %s to %s", e.Existing, e.Replacement)
+}
+
+var (
+	taskTypesMutex sync.RWMutex
+	taskTypes      = map[string]TaskType{}
+)
+
+// RegisterTaskType makes a task type available to DecodeTask and EncodeTask.
+// It panics if a type with the same name is already registered,
+// or if any of the functions are nil.
+func RegisterTaskType(taskType TaskType) {
+	taskTypesMutex.Lock()
+	defer taskTypesMutex.Unlock()
+
+	if taskType.Decode == nil || taskType.Validate == nil || taskType.Encode == nil {
+		panic(fmt.Sprintf("Incomplete task type: %s", taskType.Name))
+	}
+
+	if _, exists := taskTypes[taskType.Name]; exists {
+		panic(fmt.Sprintf("Task type already registered: %s", taskType.Name))
+	}
+
+	taskTypes[taskType.Name] = taskType
+}
+
+// unregisterTaskType removes a task type registered via RegisterTaskType,
+// e.g. one registered by a test.
+func unregisterTaskType(name string) {
+	taskTypesMutex.Lock()
+	defer taskTypesMutex.Unlock()
+
+	delete(taskTypes, name)
+}
+
+// TaskTypes returns the names of all registered task types, sorted by name.
+func TaskTypes() []string {
+	taskTypesMutex.RLock()
+	defer taskTypesMutex.RUnlock()
+
+	names := []string{}
+	for name := range taskTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookupTaskType(name string) (TaskType, error) {
+	taskTypesMutex.RLock()
+	defer taskTypesMutex.RUnlock()
+
+	taskType, ok := taskTypes[name]
+	if !ok {
+		return TaskType{}, UnrecognizedTaskTypeError{Type: name}
+	}
+	return taskType, nil
+}
+
+// DecodeTask builds and validates an unscheduled task, without an ID,
+// from its JSON representation, using the registered type named by the
+// "type" field. Any "id" or "entryID" field is ignored; the "timezone",
+// "timeout", "retry", "concurrencyPolicy" and "paused" fields apply to tasks
+// of every type.
+func DecodeTask(b []byte, logger lager.Logger) (Task, error) {
+	var base BaseTaskJson
+	err := json.Unmarshal(b, &base)
+	if err != nil {
+		return nil, err
+	}
+
+	if base.Schedule == "" {
+		return nil, errors.New("Schedule must be provided")
+	}
+
+	_, err = ParseSchedule(base.Schedule)
+	if err != nil {
+		return nil, err
+	}
+
+	if base.Timezone != "" {
+		if strings.HasPrefix(base.Schedule, timezonePrefix) {
+			return nil, errors.New("Timezone cannot be provided for a schedule with a TZ= prefix")
+		}
+
+		err = ValidateTimezone(base.Timezone)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if base.Type == "" {
+		return nil, errors.New("Task type must be provided")
+	}
+
+	var timeout time.Duration
+	if base.Timeout != "" {
+		timeout, err = time.ParseDuration(base.Timeout)
+		if err != nil {
+			return nil, err
+		}
+
+		if timeout < 0 {
+			return nil, errors.New("Timeout must not be negative")
+		}
+	}
+
+	if base.ConcurrencyPolicy != "" && !validConcurrencyPolicy(base.ConcurrencyPolicy) {
+		return nil, fmt.Errorf(
+			"Concurrency policy must be one of %s",
+			strings.Join(concurrencyPolicies, ", "))
+	}
+
+	var retryPolicy *RetryPolicy
+	if base.Retry != nil {
+		retryPolicy, err = decodeRetryPolicy(*base.Retry)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	taskType, err := lookupTaskType(base.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	task, err := taskType.Decode(b, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	err = taskType.Validate(task)
+	if err != nil {
+		return nil, err
+	}
+
+	task.SetTimezone(base.Timezone)
+	task.SetTimeout(timeout)
+	task.SetRetryPolicy(retryPolicy)
+	task.SetConcurrencyPolicy(base.ConcurrencyPolicy)
+	task.SetPaused(base.Paused)
+	return task, nil
+}
+
+func validConcurrencyPolicy(policy string) bool {
+	for _, valid := range concurrencyPolicies {
+		if policy == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// EncodeTask serializes the task in full, including secrets omitted from AsJSON,
+// such that it can be restored via DecodeTask.
+func EncodeTask(task Task) ([]byte, error) {
+	taskType, err := lookupTaskType(task.Type())
+	if err != nil {
+		return nil, err
+	}
+	return taskType.Encode(task)
+}
+
+// DecodeReplacementTask builds and validates, via DecodeTask, an unscheduled
+// task without an ID to replace the given task. A missing "type" field is
+// taken to be the type of the given task; any other type is an error.
+// A missing "paused" field is likewise taken from the given task.
+func DecodeReplacementTask(task Task, b []byte, logger lager.Logger) (Task, error) {
+	var fields map[string]interface{}
+	err := json.Unmarshal(b, &fields)
+	if err != nil {
+		return nil, err
+	}
+
+	if fields == nil {
+		return nil, errors.New("Task must be a JSON object")
+	}
+
+	if _, ok := fields["type"]; !ok {
+		fields["type"] = task.Type()
+	}
+
+	if _, ok := fields["paused"]; !ok {
+		fields["paused"] = task.Paused()
+	}
+
+	if fields["type"] != task.Type() {
+		return nil, TaskTypeChangedError{
+			Existing:    task.Type(),
+			Replacement: fmt.Sprint(fields["type"]),
+		}
+	}
+
+	b, err = json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	return DecodeTask(b, logger)
+}
+
+// PatchTask builds and validates, via DecodeTask, an unscheduled task without
+// an ID to replace the given task, by applying patch as a JSON merge patch
+// (RFC 7386) to the full representation of the task given by EncodeTask.
+// Attributes absent from the patch, including secrets, are therefore retained.
+func PatchTask(task Task, patch []byte, logger lager.Logger) (Task, error) {
+	var patchFields map[string]interface{}
+	err := json.Unmarshal(patch, &patchFields)
+	if err != nil {
+		return nil, err
+	}
+
+	if patchFields == nil {
+		return nil, errors.New("Patch must be a JSON object")
+	}
+
+	encoded, err := EncodeTask(task)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]interface{}
+	err = json.Unmarshal(encoded, &fields)
+	if err != nil {
+		return nil, err
+	}
+
+	merged, err := json.Marshal(mergePatch(fields, patchFields))
+	if err != nil {
+		return nil, err
+	}
+
+	return DecodeReplacementTask(task, merged, logger)
+}
+
+func mergePatch(target, patch map[string]interface{}) map[string]interface{} {
+	for key, value := range patch {
+		if value == nil {
+			delete(target, key)
+			continue
+		}
+
+		patchObject, ok := value.(map[string]interface{})
+		if !ok {
+			target[key] = value
+			continue
+		}
+
+		targetObject, ok := target[key].(map[string]interface{})
+		if !ok {
+			targetObject = map[string]interface{}{}
+		}
+		target[key] = mergePatch(targetObject, patchObject)
+	}
+	return target
+}
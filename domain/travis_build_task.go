@@ -0,0 +1,200 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/prodda/prodda/client"
+	"github.com/pivotal-golang/lager"
+)
+
+const (
+	TravisBuildTaskType = "travis-build"
+)
+
+// TravisBuildTask triggers a new build of a branch, unlike a TravisTask,
+// which re-runs an existing build.
+type TravisBuildTask struct {
+	BaseTask
+	endpoint string
+	token    string
+	slug     string
+	branch   string
+	message  string
+	config   map[string]interface{}
+	wait     *TravisWait
+}
+
+type TravisBuildTaskJSON struct {
+	BaseTaskJson
+	Endpoint string                 `json:"endpoint,omitempty"`
+	Slug     string                 `json:"slug"`
+	Branch   string                 `json:"branch"`
+	Message  string                 `json:"message,omitempty"`
+	Config   map[string]interface{} `json:"config,omitempty"`
+	Wait     *TravisWaitJSON        `json:"wait,omitempty"`
+}
+
+type travisBuildTaskRecord struct {
+	TravisBuildTaskJSON
+	Token string `json:"token"`
+}
+
+func init() {
+	RegisterTaskType(TaskType{
+		Name:     TravisBuildTaskType,
+		Decode:   decodeTravisBuildTask,
+		Validate: validateTravisBuildTask,
+		Encode:   encodeTravisBuildTask,
+	})
+}
+
+// NewTravisBuildTask returns a task which triggers a build of the branch of
+// the repository with the given slug, e.g. "prodda/prodda", via the Travis API
+// at endpoint, or the default endpoint if it is empty. message and config are
+// optional.
+func NewTravisBuildTask(
+	schedule string,
+	endpoint string,
+	token string,
+	slug string,
+	branch string,
+	message string,
+	config map[string]interface{},
+	logger lager.Logger,
+) *TravisBuildTask {
+	t := &TravisBuildTask{
+		endpoint: endpoint,
+		token:    token,
+		slug:     slug,
+		branch:   branch,
+		message:  message,
+		config:   config,
+	}
+
+	t.logger = logger
+	t.SetSchedule(schedule)
+
+	return t
+}
+
+func decodeTravisBuildTask(b []byte, logger lager.Logger) (Task, error) {
+	var record travisBuildTaskRecord
+	err := json.Unmarshal(b, &record)
+	if err != nil {
+		return nil, err
+	}
+
+	wait, err := decodeTravisWait(record.Wait)
+	if err != nil {
+		return nil, err
+	}
+
+	t := NewTravisBuildTask(
+		record.Schedule,
+		record.Endpoint,
+		record.Token,
+		record.Slug,
+		record.Branch,
+		record.Message,
+		record.Config,
+		logger,
+	)
+	t.SetWait(wait)
+
+	return t, nil
+}
+
+func validateTravisBuildTask(task Task) error {
+	t := task.(*TravisBuildTask)
+
+	if t.token == "" {
+		return errors.New("Token must be provided")
+	}
+
+	if t.slug == "" {
+		return errors.New("Slug must be provided")
+	}
+
+	if parts := strings.Split(t.slug, "/"); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return errors.New("Slug must be of the form owner/repository")
+	}
+
+	if t.branch == "" {
+		return errors.New("Branch must be provided")
+	}
+
+	return validateEndpoint(t.endpoint)
+}
+
+func encodeTravisBuildTask(task Task) ([]byte, error) {
+	t := task.(*TravisBuildTask)
+
+	return json.Marshal(travisBuildTaskRecord{
+		TravisBuildTaskJSON: t.AsJSON().(TravisBuildTaskJSON),
+		Token:               t.token,
+	})
+}
+
+func (t *TravisBuildTask) Type() string {
+	return TravisBuildTaskType
+}
+
+// SetWait determines whether, and for how long, executions wait for the
+// triggered build to finish. Executions do not wait if wait is nil.
+func (t *TravisBuildTask) SetWait(wait *TravisWait) {
+	t.wait = wait
+}
+
+func (t *TravisBuildTask) Execute(ctx context.Context) (Result, error) {
+	travis := travisClient(t.endpoint)
+
+	response, err := travis.TriggerBranchBuild(ctx, t.token, t.slug, client.BuildRequest{
+		Branch:  t.branch,
+		Message: t.message,
+		Config:  t.config,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	t.logger.Info("Task response", lager.Data{"task": t.AsJSON(), "response": response})
+
+	result := Result{
+		"requestID":         response.Request.Id,
+		"remainingRequests": response.RemainingRequests,
+	}
+
+	if t.wait == nil {
+		return result, nil
+	}
+
+	// The build is not known until Travis has processed the request.
+	poll := func(ctx context.Context) (*client.Build, error) {
+		status, err := travis.BuildRequestStatus(ctx, t.token, t.slug, response.Request.Id)
+		if err != nil || len(status.Builds) == 0 {
+			return nil, err
+		}
+		return &status.Builds[0], nil
+	}
+	return result, t.wait.waitForBuild(ctx, poll, nil, result, t, t.logger)
+}
+
+func (t *TravisBuildTask) AsJSON() TaskJSON {
+	asJson := TravisBuildTaskJSON{
+		BaseTaskJson: t.baseJSON(t.Type()),
+		Endpoint:     t.endpoint,
+		Slug:         t.slug,
+		Branch:       t.branch,
+		Message:      t.message,
+		Config:       t.config,
+	}
+
+	if t.wait != nil {
+		asJson.Wait = t.wait.AsJSON()
+	}
+
+	return asJson
+}
@@ -0,0 +1,77 @@
+package domain_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/prodda/prodda/domain"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+)
+
+var _ = Describe("Travis build task", func() {
+	var testLogger *lagertest.TestLogger
+
+	BeforeEach(func() {
+		testLogger = lagertest.NewTestLogger("travis build task test")
+	})
+
+	It("omits the token from its JSON representation, retaining it when encoded", func() {
+		task := domain.NewTravisBuildTask(
+			"@daily",
+			"",
+			"some-token",
+			"prodda/prodda",
+			"master",
+			"Nightly build",
+			map[string]interface{}{"env": "NIGHTLY=true"},
+			testLogger,
+		)
+
+		asJSON := task.AsJSON().(domain.TravisBuildTaskJSON)
+		Expect(asJSON.Slug).To(Equal("prodda/prodda"))
+		Expect(asJSON.Branch).To(Equal("master"))
+		Expect(asJSON.Message).To(Equal("Nightly build"))
+		Expect(asJSON.Config).To(Equal(map[string]interface{}{"env": "NIGHTLY=true"}))
+
+		b, err := domain.EncodeTask(task)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(b)).To(ContainSubstring("some-token"))
+
+		decoded, err := domain.DecodeTask(b, testLogger)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(decoded.AsJSON()).To(Equal(task.AsJSON()))
+	})
+
+	It("validates its attributes", func() {
+		decode := func(fields string) error {
+			_, err := domain.DecodeTask([]byte(`{"schedule":"@daily","type":"travis-build",`+fields+`}`), testLogger)
+			return err
+		}
+
+		Expect(decode(`"slug":"prodda/prodda","branch":"master"`)).To(MatchError("Token must be provided"))
+		Expect(decode(`"token":"some-token","branch":"master"`)).To(MatchError("Slug must be provided"))
+		Expect(decode(`"token":"some-token","slug":"prodda","branch":"master"`)).To(MatchError("Slug must be of the form owner/repository"))
+		Expect(decode(`"token":"some-token","slug":"prodda/prodda"`)).To(MatchError("Branch must be provided"))
+		Expect(decode(`"token":"some-token","slug":"prodda/prodda","branch":"master"`)).To(Succeed())
+	})
+
+	It("triggers a build via the endpoint of the task", func() {
+		paths := make(chan string, 1)
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			paths <- r.URL.EscapedPath()
+			rw.WriteHeader(http.StatusAccepted)
+			rw.Write([]byte(`{"@type":"pending","remaining_requests":9,"request":{"id":1234}}`))
+		}))
+		defer server.Close()
+
+		task := domain.NewTravisBuildTask("@daily", server.URL, "some-token", "prodda/prodda", "master", "", nil, testLogger)
+
+		result, err := task.Execute(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(domain.Result{"requestID": 1234, "remainingRequests": 9}))
+		Expect(paths).To(Receive(Equal("/repo/prodda%2Fprodda/requests")))
+	})
+})
@@ -1,31 +1,62 @@
 package domain
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+
 	"github.com/prodda/prodda/client"
 	"github.com/pivotal-golang/lager"
 )
 
 const (
 	TravisTaskType = "travis-re-run"
+
+	// DefaultTravisEndpoint is the Travis API endpoint of travis tasks which
+	// do not specify one, unless configured via SetDefaultTravisEndpoint.
+	DefaultTravisEndpoint = "https://api.travis-ci.com"
 )
 
+var travisEndpoint = newDefaultEndpoint(DefaultTravisEndpoint)
+
 type TravisTask struct {
 	BaseTask
-	client  *client.Travis
-	token   string
-	buildID uint
+	endpoint string
+	token    string
+	buildID  uint
+	wait     *TravisWait
 }
 
+// TravisTaskJSON omits the endpoint of tasks which use the default endpoint.
 type TravisTaskJSON struct {
 	BaseTaskJson
-	BuildID uint `json:"buildID"`
+	Endpoint string          `json:"endpoint,omitempty"`
+	BuildID  uint            `json:"buildID"`
+	Wait     *TravisWaitJSON `json:"wait,omitempty"`
 }
 
-func NewTravisTask(schedule, token string, buildID uint, logger lager.Logger) *TravisTask {
+type travisTaskRecord struct {
+	TravisTaskJSON
+	Token string `json:"token"`
+}
+
+func init() {
+	RegisterTaskType(TaskType{
+		Name:     TravisTaskType,
+		Decode:   decodeTravisTask,
+		Validate: validateTravisTask,
+		Encode:   encodeTravisTask,
+	})
+}
+
+// NewTravisTask returns a task which re-runs the build via the Travis API at
+// endpoint, e.g. "https://travis.example.com/api", or the default endpoint
+// if it is empty.
+func NewTravisTask(schedule, endpoint, token string, buildID uint, logger lager.Logger) *TravisTask {
 	t := &TravisTask{
-		client:  client.NewTravisClient("https://api.travis-ci.org"),
-		token:   token,
-		buildID: buildID,
+		endpoint: endpoint,
+		token:    token,
+		buildID:  buildID,
 	}
 
 	t.logger = logger
@@ -34,23 +65,114 @@ func NewTravisTask(schedule, token string, buildID uint, logger lager.Logger) *T
 	return t
 }
 
-func (t TravisTask) Run() {
-	t.logger.Info("Task started", lager.Data{"task": t.AsJSON()})
+func decodeTravisTask(b []byte, logger lager.Logger) (Task, error) {
+	var record travisTaskRecord
+	err := json.Unmarshal(b, &record)
+	if err != nil {
+		return nil, err
+	}
+
+	wait, err := decodeTravisWait(record.Wait)
+	if err != nil {
+		return nil, err
+	}
+
+	t := NewTravisTask(record.Schedule, record.Endpoint, record.Token, record.BuildID, logger)
+	t.SetWait(wait)
+
+	return t, nil
+}
+
+func validateTravisTask(task Task) error {
+	t := task.(*TravisTask)
 
-	response, _ := t.client.TriggerBuild(t.token, t.buildID)
-	t.logger.Info("Task completed", lager.Data{"task": t.AsJSON(), "response": response})
-	return
+	if t.token == "" {
+		return errors.New("Token must be provided")
+	}
+
+	if t.buildID == 0 {
+		return errors.New("BuildID must be provided")
+	}
+
+	return validateEndpoint(t.endpoint)
 }
 
-func (t TravisTask) AsJSON() TaskJSON {
+func encodeTravisTask(task Task) ([]byte, error) {
+	t := task.(*TravisTask)
+
+	return json.Marshal(travisTaskRecord{
+		TravisTaskJSON: t.AsJSON().(TravisTaskJSON),
+		Token:          t.token,
+	})
+}
+
+func (t *TravisTask) Type() string {
+	return TravisTaskType
+}
+
+// SetWait determines whether, and for how long, executions wait for the
+// re-run build to finish. Executions do not wait if wait is nil.
+func (t *TravisTask) SetWait(wait *TravisWait) {
+	t.wait = wait
+}
+
+func (t *TravisTask) Execute(ctx context.Context) (Result, error) {
+	travis := travisClient(t.endpoint)
+
+	// The state of the build before it is re-run distinguishes the outcome
+	// of the re-run from that of the previous run.
+	var previous *client.Build
+	if t.wait != nil {
+		var err error
+		previous, err = travis.Build(ctx, t.token, int(t.buildID))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	response, err := travis.TriggerBuild(ctx, t.token, t.buildID)
+	if err != nil {
+		return nil, err
+	}
+
+	t.logger.Info("Task response", lager.Data{"task": t.AsJSON(), "response": response})
+
+	result := Result{
+		"stateChange": response.StateChange,
+	}
+
+	if t.wait == nil {
+		return result, nil
+	}
+
+	poll := func(ctx context.Context) (*client.Build, error) {
+		return travis.Build(ctx, t.token, int(t.buildID))
+	}
+	return result, t.wait.waitForBuild(ctx, poll, previous, result, t, t.logger)
+}
+
+func (t *TravisTask) AsJSON() TaskJSON {
 	asJson := TravisTaskJSON{
-		BuildID: t.buildID,
+		BaseTaskJson: t.baseJSON(t.Type()),
+		Endpoint:     t.endpoint,
+		BuildID:      t.buildID,
 	}
 
-	asJson.Type = TravisTaskType
-	asJson.ID = t.ID()
-	asJson.Schedule = t.Schedule()
-	asJson.EntryID = t.EntryID()
+	if t.wait != nil {
+		asJson.Wait = t.wait.AsJSON()
+	}
 
 	return asJson
 }
+
+// SetDefaultTravisEndpoint sets the Travis API endpoint of travis tasks which
+// do not specify one, returning an error if it is not an http or https URL.
+func SetDefaultTravisEndpoint(endpoint string) error {
+	return travisEndpoint.set(endpoint)
+}
+
+// travisClient returns a client of the Travis API at endpoint,
+// or at the default endpoint if it is empty.
+func travisClient(endpoint string) *client.Travis {
+	return client.NewTravisClient(travisEndpoint.resolve(endpoint))
+}
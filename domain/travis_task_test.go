@@ -0,0 +1,85 @@
+package domain_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/prodda/prodda/domain"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+)
+
+var _ = Describe("Travis task", func() {
+	var (
+		testLogger *lagertest.TestLogger
+		server     *httptest.Server
+		paths      chan string
+	)
+
+	BeforeEach(func() {
+		testLogger = lagertest.NewTestLogger("travis task test")
+
+		received := make(chan string, 1)
+		paths = received
+		server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			received <- r.URL.EscapedPath()
+			rw.WriteHeader(http.StatusAccepted)
+			rw.Write([]byte(`{"@type":"pending","build":{"id":1234,"state":"passed"},"state_change":"restart","resource_type":"build"}`))
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("re-runs the build via the endpoint of the task", func() {
+		task := domain.NewTravisTask("@daily", server.URL+"/", "some-token", 1234, testLogger)
+
+		result, err := task.Execute(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(HaveKeyWithValue("stateChange", "restart"))
+		Expect(paths).To(Receive(Equal("/build/1234/restart")))
+	})
+
+	It("fails runs which Travis refuses", func() {
+		refusingServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			rw.WriteHeader(http.StatusConflict)
+			rw.Write([]byte(`{"@type":"error","error_type":"job_already_running","error_message":"build already running, cannot restart"}`))
+		}))
+		defer refusingServer.Close()
+
+		task := domain.NewTravisTask("@daily", refusingServer.URL, "some-token", 1234, testLogger)
+
+		_, err := task.Execute(context.Background())
+		Expect(err).To(MatchError("Travis API returned status code 409: build already running, cannot restart"))
+	})
+
+	It("uses the default endpoint for tasks which do not specify one", func() {
+		err := domain.SetDefaultTravisEndpoint(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+		defer domain.SetDefaultTravisEndpoint(domain.DefaultTravisEndpoint)
+
+		task := domain.NewTravisTask("@daily", "", "some-token", 1234, testLogger)
+		Expect(task.AsJSON().(domain.TravisTaskJSON).Endpoint).To(BeEmpty())
+
+		_, err = task.Execute(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(paths).To(Receive(Equal("/build/1234/restart")))
+	})
+
+	It("validates the endpoint", func() {
+		_, err := domain.DecodeTask([]byte(`{"schedule":"@daily","type":"travis-re-run","token":"some-token","buildID":1,"endpoint":"travis.example.com"}`), testLogger)
+		Expect(err).To(MatchError(`Endpoint must be an http or https URL: "travis.example.com"`))
+
+		_, err = domain.DecodeTask([]byte(`{"schedule":"@daily","type":"travis-build","token":"some-token","slug":"prodda/prodda","branch":"master","endpoint":"ftp://travis.example.com"}`), testLogger)
+		Expect(err).To(MatchError(`Endpoint must be an http or https URL: "ftp://travis.example.com"`))
+
+		_, err = domain.DecodeTask([]byte(`{"schedule":"@daily","type":"travis-re-run","token":"some-token","buildID":1,"endpoint":"https://travis.example.com/api"}`), testLogger)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(domain.SetDefaultTravisEndpoint("")).To(MatchError("Endpoint must be provided"))
+		Expect(domain.SetDefaultTravisEndpoint("travis.example.com")).To(MatchError(`Endpoint must be an http or https URL: "travis.example.com"`))
+	})
+})
@@ -0,0 +1,179 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prodda/prodda/client"
+	"github.com/pivotal-golang/lager"
+)
+
+const (
+	defaultTravisPollInterval = 30 * time.Second
+	defaultTravisWaitDeadline = time.Hour
+)
+
+// TravisWait determines how travis tasks wait for the outcome of the build
+// they trigger, polling its state every Interval until it finishes or until
+// Deadline has elapsed since the build was triggered.
+type TravisWait struct {
+	Interval time.Duration
+	Deadline time.Duration
+}
+
+type TravisWaitJSON struct {
+	Interval string `json:"interval,omitempty"`
+	Deadline string `json:"deadline,omitempty"`
+}
+
+// BuildFailedError is returned when a build waited for by a travis task does
+// not pass. Its outcome distinguishes failed and cancelled builds from those
+// which errored or which did not finish before the deadline.
+type BuildFailedError struct {
+	BuildID int
+	State   string
+	outcome string
+}
+
+func (e BuildFailedError) Error() string {
+	if e.outcome == RunTimedOut && e.BuildID == 0 {
+		return "Build did not start before the deadline"
+	}
+	if e.outcome == RunTimedOut {
+		return fmt.Sprintf("Build %d did not finish before the deadline; last state %q", e.BuildID, e.State)
+	}
+	return fmt.Sprintf("Build %d %s", e.BuildID, e.State)
+}
+
+func (e BuildFailedError) Outcome() string {
+	return e.outcome
+}
+
+// decodeTravisWait builds a TravisWait from its JSON representation,
+// applying defaults for omitted attributes. It returns nil if asJSON is nil.
+func decodeTravisWait(asJSON *TravisWaitJSON) (*TravisWait, error) {
+	if asJSON == nil {
+		return nil, nil
+	}
+
+	wait := &TravisWait{
+		Interval: defaultTravisPollInterval,
+		Deadline: defaultTravisWaitDeadline,
+	}
+
+	var err error
+	if asJSON.Interval != "" {
+		wait.Interval, err = time.ParseDuration(asJSON.Interval)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if asJSON.Deadline != "" {
+		wait.Deadline, err = time.ParseDuration(asJSON.Deadline)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if wait.Interval <= 0 || wait.Deadline <= 0 {
+		return nil, errors.New("Wait interval and deadline must be positive")
+	}
+
+	return wait, nil
+}
+
+func (w *TravisWait) AsJSON() *TravisWaitJSON {
+	return &TravisWaitJSON{
+		Interval: w.Interval.String(),
+		Deadline: w.Deadline.String(),
+	}
+}
+
+// pollBuild returns the build being waited for, or nil if it is not yet known.
+type pollBuild func(ctx context.Context) (*client.Build, error)
+
+// waitForBuild polls the build every interval until it reaches a terminal
+// state, recording its ID and state in result. It returns nil only if the
+// build passed. previous is the state of a re-run build before it was
+// re-run, or nil for a new build: a terminal state is only taken as the
+// outcome of a re-run build once it has been seen in a non-terminal state,
+// or has started or finished since previous. Failures to poll are logged,
+// and polling continues until the deadline, unless the token is rejected or
+// the build does not exist.
+func (w *TravisWait) waitForBuild(
+	ctx context.Context,
+	poll pollBuild,
+	previous *client.Build,
+	result Result,
+	task Task,
+	logger lager.Logger,
+) error {
+	deadline := time.After(w.Deadline)
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	restarted := previous == nil
+	var build client.Build
+	for {
+		select {
+		case <-ticker.C:
+		case <-deadline:
+			return BuildFailedError{BuildID: build.Id, State: build.State, outcome: RunTimedOut}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		polled, err := poll(ctx)
+		if err != nil {
+			if permanentPollError(err) {
+				return err
+			}
+			logger.Error("Failed to poll build", err, lager.Data{"task": task.AsJSON()})
+			continue
+		}
+		if polled == nil {
+			continue
+		}
+
+		if !restarted {
+			restarted = !terminalBuildState(polled.State) ||
+				polled.StartedAt != previous.StartedAt ||
+				polled.FinishedAt != previous.FinishedAt
+			if !restarted {
+				continue
+			}
+		}
+
+		build = *polled
+		result["buildID"] = build.Id
+		result["buildState"] = build.State
+
+		switch build.State {
+		case "passed":
+			logger.Info("Build passed", lager.Data{"task": task.AsJSON(), "build": build})
+			return nil
+		case "failed", "canceled":
+			return BuildFailedError{BuildID: build.Id, State: build.State, outcome: RunFailed}
+		case "errored":
+			return BuildFailedError{BuildID: build.Id, State: build.State, outcome: RunErrored}
+		}
+	}
+}
+
+func terminalBuildState(state string) bool {
+	switch state {
+	case "passed", "failed", "canceled", "errored":
+		return true
+	}
+	return false
+}
+
+// permanentPollError returns true if polling again cannot succeed.
+func permanentPollError(err error) bool {
+	var authenticationErr client.AuthenticationError
+	var notFoundErr client.NotFoundError
+	return errors.As(err, &authenticationErr) || errors.As(err, &notFoundErr)
+}
@@ -0,0 +1,194 @@
+package domain_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/prodda/prodda/client"
+	"github.com/prodda/prodda/domain"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+)
+
+var _ = Describe("Waiting for travis builds", func() {
+	var (
+		testLogger *lagertest.TestLogger
+		server     *httptest.Server
+		builds     chan client.Build
+	)
+
+	push := func(states ...string) {
+		for _, state := range states {
+			builds <- client.Build{State: state}
+		}
+	}
+
+	BeforeEach(func() {
+		testLogger = lagertest.NewTestLogger("travis wait test")
+
+		queued := make(chan client.Build, 10)
+		builds = queued
+
+		// Each poll of the build takes the next queued build. Builds in the
+		// "forbidden" state are served as a rejected token.
+		nextBuild := func(rw http.ResponseWriter) (client.Build, bool) {
+			build := <-queued
+			build.Id = 1234
+			if build.State == "forbidden" {
+				rw.WriteHeader(http.StatusForbidden)
+				rw.Write([]byte(`{"error_message":"access denied"}`))
+				return build, false
+			}
+			return build, true
+		}
+
+		server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			switch r.URL.EscapedPath() {
+			case "/build/1234/restart":
+				rw.WriteHeader(http.StatusAccepted)
+				rw.Write([]byte(`{"@type":"pending","build":{"id":1234},"state_change":"restart","resource_type":"build"}`))
+			case "/repo/prodda%2Fprodda/requests":
+				rw.WriteHeader(http.StatusAccepted)
+				rw.Write([]byte(`{"@type":"pending","remaining_requests":9,"request":{"id":42}}`))
+			case "/repo/prodda%2Fprodda/request/42":
+				if build, ok := nextBuild(rw); ok {
+					b, _ := json.Marshal(build)
+					rw.Write([]byte(fmt.Sprintf(`{"id":42,"builds":[%s]}`, b)))
+				}
+			case "/build/1234":
+				if build, ok := nextBuild(rw); ok {
+					json.NewEncoder(rw).Encode(build)
+				}
+			default:
+				rw.WriteHeader(http.StatusNotFound)
+			}
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	decode := func(fields string) (domain.Task, error) {
+		return domain.DecodeTask([]byte(`{
+			"schedule": "@daily",
+			"token": "some-token",
+			"endpoint": "`+server.URL+`",
+			`+fields+`
+		}`), testLogger)
+	}
+
+	It("records the state of re-run builds which pass", func() {
+		push("failed", "started", "passed")
+
+		task, err := decode(`"type": "travis-re-run", "buildID": 1234, "wait": {"interval": "1ms"}`)
+		Expect(err).NotTo(HaveOccurred())
+
+		result, err := task.Execute(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(HaveKeyWithValue("buildID", 1234))
+		Expect(result).To(HaveKeyWithValue("buildState", "passed"))
+	})
+
+	It("fails runs whose triggered build fails or errors, with the corresponding outcome", func() {
+		task, err := decode(`"type": "travis-build", "slug": "prodda/prodda", "branch": "master", "wait": {"interval": "1ms"}`)
+		Expect(err).NotTo(HaveOccurred())
+
+		push("created", "failed")
+		result, err := task.Execute(context.Background())
+		Expect(err).To(MatchError("Build 1234 failed"))
+		Expect(err.(domain.OutcomeError).Outcome()).To(Equal(domain.RunFailed))
+		Expect(result).To(HaveKeyWithValue("requestID", 42))
+		Expect(result).To(HaveKeyWithValue("buildState", "failed"))
+
+		push("errored")
+		_, err = task.Execute(context.Background())
+		Expect(err.(domain.OutcomeError).Outcome()).To(Equal(domain.RunErrored))
+	})
+
+	It("times out runs whose build does not finish before the deadline", func() {
+		for i := 0; i < cap(builds); i++ {
+			push("started")
+		}
+
+		task, err := decode(`"type": "travis-re-run", "buildID": 1234, "wait": {"interval": "1ms", "deadline": "5ms"}`)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = task.Execute(context.Background())
+		Expect(err).To(MatchError(`Build 1234 did not finish before the deadline; last state "started"`))
+		Expect(err.(domain.OutcomeError).Outcome()).To(Equal(domain.RunTimedOut))
+	})
+
+	It("does not mistake the previous outcome of re-run builds for that of the re-run", func() {
+		push("passed", "passed", "passed", "started", "failed")
+
+		task, err := decode(`"type": "travis-re-run", "buildID": 1234, "wait": {"interval": "1ms"}`)
+		Expect(err).NotTo(HaveOccurred())
+
+		result, err := task.Execute(context.Background())
+		Expect(err).To(MatchError("Build 1234 failed"))
+		Expect(result).To(HaveKeyWithValue("buildState", "failed"))
+		Expect(builds).To(BeEmpty())
+	})
+
+	It("recognises re-run builds which finish again between polls", func() {
+		builds <- client.Build{State: "failed", FinishedAt: "2015-06-01T10:00:00Z"}
+		builds <- client.Build{State: "failed", FinishedAt: "2015-06-01T10:00:00Z"}
+		builds <- client.Build{State: "passed", FinishedAt: "2015-06-01T11:00:00Z"}
+
+		task, err := decode(`"type": "travis-re-run", "buildID": 1234, "wait": {"interval": "1ms"}`)
+		Expect(err).NotTo(HaveOccurred())
+
+		result, err := task.Execute(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(HaveKeyWithValue("buildState", "passed"))
+	})
+
+	It("times out re-run builds which are not seen to restart", func() {
+		for i := 0; i < cap(builds); i++ {
+			push("passed")
+		}
+
+		task, err := decode(`"type": "travis-re-run", "buildID": 1234, "wait": {"interval": "1ms", "deadline": "5ms"}`)
+		Expect(err).NotTo(HaveOccurred())
+
+		result, err := task.Execute(context.Background())
+		Expect(err).To(MatchError("Build did not start before the deadline"))
+		Expect(result).NotTo(HaveKey("buildState"))
+	})
+
+	It("stops waiting as soon as the token is rejected", func() {
+		push("created", "forbidden")
+
+		task, err := decode(`"type": "travis-build", "slug": "prodda/prodda", "branch": "master", "wait": {"interval": "1ms", "deadline": "1h"}`)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = task.Execute(context.Background())
+		Expect(err).To(BeAssignableToTypeOf(client.AuthenticationError{}))
+	})
+
+	It("does not wait unless configured to", func() {
+		task, err := decode(`"type": "travis-re-run", "buildID": 1234`)
+		Expect(err).NotTo(HaveOccurred())
+
+		result, err := task.Execute(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).NotTo(HaveKey("buildState"))
+	})
+
+	It("applies defaults and validates the wait", func() {
+		task, err := decode(`"type": "travis-re-run", "buildID": 1234, "wait": {}`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(task.AsJSON().(domain.TravisTaskJSON).Wait).To(Equal(&domain.TravisWaitJSON{Interval: "30s", Deadline: "1h0m0s"}))
+
+		_, err = decode(`"type": "travis-re-run", "buildID": 1234, "wait": {"interval": "0s"}`)
+		Expect(err).To(MatchError("Wait interval and deadline must be positive"))
+
+		_, err = decode(`"type": "travis-build", "slug": "prodda/prodda", "branch": "master", "wait": {"deadline": "soon"}`)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -1,8 +1,13 @@
 package domain
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
+	"time"
 
 	"github.com/pivotal-golang/lager"
 )
@@ -13,17 +18,35 @@ const (
 
 type URLGetTask struct {
 	BaseTask
-	url string
+	url        string
+	assertions *Assertions
 }
 
 type URLGetTaskJSON struct {
 	BaseTaskJson
-	URL string `json:"url"`
+	URL        string          `json:"url"`
+	Assertions *AssertionsJSON `json:"assertions,omitempty"`
+}
+
+func init() {
+	RegisterTaskType(TaskType{
+		Name:     URLGetTaskType,
+		Decode:   decodeURLGetTask,
+		Validate: validateURLGetTask,
+		Encode:   encodeURLGetTask,
+	})
 }
 
 func NewURLGetTask(schedule, url string, logger lager.Logger) *URLGetTask {
+	return NewURLGetTaskWithAssertions(schedule, url, nil, logger)
+}
+
+// NewURLGetTaskWithAssertions returns a URLGetTask whose executions fail if
+// the response does not meet the assertions, which may be nil.
+func NewURLGetTaskWithAssertions(schedule, url string, assertions *Assertions, logger lager.Logger) *URLGetTask {
 	t := &URLGetTask{
-		url: url,
+		url:        url,
+		assertions: assertions,
 	}
 
 	t.SetSchedule(schedule)
@@ -32,76 +55,111 @@ func NewURLGetTask(schedule, url string, logger lager.Logger) *URLGetTask {
 	return t
 }
 
-func (t URLGetTask) Run() {
-	t.logger.Info("Task started", lager.Data{"task": t.AsJSON()})
+func decodeURLGetTask(b []byte, logger lager.Logger) (Task, error) {
+	var record URLGetTaskJSON
+	err := json.Unmarshal(b, &record)
+	if err != nil {
+		return nil, err
+	}
+
+	assertions, err := decodeAssertions(record.Assertions)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewURLGetTaskWithAssertions(record.Schedule, record.URL, assertions, logger), nil
+}
+
+func validateURLGetTask(task Task) error {
+	t := task.(*URLGetTask)
+
+	if t.url == "" {
+		return errors.New("URL must be provided")
+	}
+
+	return nil
+}
+
+func encodeURLGetTask(task Task) ([]byte, error) {
+	return json.Marshal(task.AsJSON())
+}
+
+func (t *URLGetTask) Type() string {
+	return URLGetTaskType
+}
 
-	t.execute()
+func (t *URLGetTask) Execute(ctx context.Context) (Result, error) {
+	req, err := http.NewRequest("GET", t.url, nil)
+	if err != nil {
+		return nil, err
+	}
 
-	t.logger.Info("Task completed", lager.Data{"task": t.AsJSON()})
-	return
+	return executeRequest(ctx, req, t.assertions, t, t.logger)
 }
 
-func (t URLGetTask) execute() {
-	resp, err := http.Get(t.url)
+// executeRequest performs the request on behalf of the task, logging the
+// response body. It returns the status code and latency of the response,
+// and fails if the response does not meet the assertions, which may be nil.
+func executeRequest(
+	ctx context.Context,
+	req *http.Request,
+	assertions *Assertions,
+	task Task,
+	logger lager.Logger,
+) (Result, error) {
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
 	if err != nil {
-		t.logger.Info(
-			"Task encountered error",
-			lager.Data{"task": t.AsJSON(), "err": err.Error()},
-		)
-		return
+		return nil, err
 	}
 
 	if resp == nil {
-		t.logger.Info(
-			"Task received nil response",
-			lager.Data{"task": t.AsJSON()},
-		)
-		return
+		return nil, errors.New("Received nil response")
+	}
+
+	result := Result{
+		"statusCode": resp.StatusCode,
 	}
 
 	if resp.Body == nil {
-		t.logger.Info(
-			"Task received nil response body",
-			lager.Data{"task": t.AsJSON()},
-		)
-		return
+		return result, errors.New("Received nil response body")
 	}
 
 	defer resp.Body.Close()
 
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		t.logger.Info(
-			"Task encountered error reading response body",
-			lager.Data{"task": t.AsJSON(), "err": err.Error()},
-		)
-		return
+		return result, fmt.Errorf("Failed to read response body: %v", err)
 	}
 
-	if body == nil {
-		t.logger.Info(
-			"Task response body nil",
-			lager.Data{"task": t.AsJSON()},
-		)
-		return
-	}
+	latency := time.Since(start)
+	result["latency"] = latency.String()
 
-	t.logger.Info(
+	logger.Info(
 		"Task response",
-		lager.Data{"response.body": string(body)},
+		lager.Data{"task": task.AsJSON(), "response.body": string(body)},
 	)
 
+	if resp.StatusCode >= 500 && (assertions == nil || len(assertions.statusRanges) == 0) {
+		return result, ServerErrorStatusCodeError{Status: resp.StatusCode}
+	}
+
+	if assertions != nil {
+		return result, assertions.Check(resp, body, latency)
+	}
+
+	return result, nil
 }
 
-func (t URLGetTask) AsJSON() TaskJSON {
+func (t *URLGetTask) AsJSON() TaskJSON {
 	asJson := URLGetTaskJSON{
-		URL: t.url,
+		BaseTaskJson: t.baseJSON(t.Type()),
+		URL:          t.url,
 	}
 
-	asJson.Type = URLGetTaskType
-	asJson.ID = t.ID()
-	asJson.Schedule = t.Schedule()
-	asJson.EntryID = t.EntryID()
+	if t.assertions != nil {
+		asJson.Assertions = t.assertions.AsJSON()
+	}
 
 	return asJson
 }
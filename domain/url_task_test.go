@@ -0,0 +1,110 @@
+package domain_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/prodda/prodda/domain"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+)
+
+var _ = Describe("URL get task", func() {
+	var (
+		testLogger *lagertest.TestLogger
+		server     *httptest.Server
+	)
+
+	BeforeEach(func() {
+		testLogger = lagertest.NewTestLogger("url get task test")
+		server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			rw.WriteHeader(http.StatusAccepted)
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("returns the status code of the response", func() {
+		task := domain.NewURLGetTask("", server.URL, testLogger)
+
+		result, err := task.Execute(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(HaveKeyWithValue("statusCode", http.StatusAccepted))
+	})
+
+	It("returns an error when the request fails", func() {
+		server.Close()
+
+		task := domain.NewURLGetTask("", server.URL, testLogger)
+
+		_, err := task.Execute(context.Background())
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("abandons the request when cancelled", func() {
+		release := make(chan struct{})
+		slowServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			<-release
+		}))
+		defer slowServer.Close()
+		defer close(release)
+
+		task := domain.NewURLGetTask("", slowServer.URL, testLogger)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		_, err := task.Execute(ctx)
+		Expect(err).To(HaveOccurred())
+		Expect(ctx.Err()).To(Equal(context.DeadlineExceeded))
+	})
+
+	Context("when the response has a 5xx status code", func() {
+		BeforeEach(func() {
+			server.Close()
+			server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				rw.WriteHeader(http.StatusServiceUnavailable)
+			}))
+		})
+
+		It("fails with a retryable error", func() {
+			task := domain.NewURLGetTask("", server.URL, testLogger)
+
+			result, err := task.Execute(context.Background())
+			Expect(err).To(Equal(domain.ServerErrorStatusCodeError{Status: http.StatusServiceUnavailable}))
+			Expect(result).To(HaveKeyWithValue("statusCode", http.StatusServiceUnavailable))
+
+			policy := &domain.RetryPolicy{MaxAttempts: 2, RetryOn: []string{domain.RetryOnServerError}}
+			Expect(policy.Retryable(context.Background(), err)).To(BeTrue())
+		})
+
+		It("fails the same way whether or not the task has a retry policy", func() {
+			task := domain.NewURLGetTask("", server.URL, testLogger)
+			_, errWithout := task.Execute(context.Background())
+
+			task.SetRetryPolicy(&domain.RetryPolicy{MaxAttempts: 2, RetryOn: []string{domain.RetryOnServerError}})
+			_, errWith := task.Execute(context.Background())
+
+			Expect(errWith).To(Equal(errWithout))
+		})
+
+		It("succeeds when the statusCodes assertion accepts it", func() {
+			task, err := domain.DecodeTask([]byte(`{
+				"schedule": "@daily",
+				"type": "url-get",
+				"url": "`+server.URL+`",
+				"assertions": {"statusCodes": ["5xx"]}
+			}`), testLogger)
+			Expect(err).NotTo(HaveOccurred())
+
+			result, err := task.Execute(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(HaveKeyWithValue("statusCode", http.StatusServiceUnavailable))
+		})
+	})
+})
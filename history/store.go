@@ -0,0 +1,85 @@
+package history
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prodda/prodda/domain"
+)
+
+// Store records the runs of tasks.
+type Store interface {
+	domain.RunRecorder
+
+	// ByTaskID returns the runs of the task, most recent first, skipping the
+	// first offset runs and returning at most limit runs, along with the
+	// total number of runs of the task which are retained.
+	// If the task has no runs, the returned error will be nil.
+	ByTaskID(taskID uint, offset, limit int) ([]domain.Run, int, error)
+}
+
+// InMemoryStore holds runs in memory, retaining at most maxRunsPerTask runs
+// for each task, and discarding runs which started more than maxAge ago.
+// A limit of zero disables the corresponding retention rule.
+// InMemoryStore is safe for concurrent use.
+type InMemoryStore struct {
+	mutex          sync.RWMutex
+	runs           map[uint][]domain.Run // ordered oldest first
+	maxRunsPerTask int
+	maxAge         time.Duration
+}
+
+func NewInMemoryStore(maxRunsPerTask int, maxAge time.Duration) *InMemoryStore {
+	return &InMemoryStore{
+		runs:           map[uint][]domain.Run{},
+		maxRunsPerTask: maxRunsPerTask,
+		maxAge:         maxAge,
+	}
+}
+
+func (s *InMemoryStore) RecordRun(run domain.Run) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	runs := append(s.runs[run.TaskID], run)
+	s.runs[run.TaskID] = s.retained(runs)
+	return nil
+}
+
+func (s *InMemoryStore) ByTaskID(taskID uint, offset, limit int) ([]domain.Run, int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	runs := s.retained(s.runs[taskID])
+	s.runs[taskID] = runs
+
+	page := []domain.Run{}
+	for i := len(runs) - 1 - offset; i >= 0 && len(page) < limit; i-- {
+		page = append(page, runs[i])
+	}
+	return page, len(runs), nil
+}
+
+// retained applies the retention rules to runs, which are ordered oldest first.
+// It must be called with the mutex held.
+func (s *InMemoryStore) retained(runs []domain.Run) []domain.Run {
+	first := 0
+
+	if s.maxRunsPerTask > 0 && len(runs) > s.maxRunsPerTask {
+		first = len(runs) - s.maxRunsPerTask
+	}
+
+	if s.maxAge > 0 {
+		cutoff := time.Now().Add(-s.maxAge)
+		for first < len(runs) && runs[first].StartTime.Before(cutoff) {
+			first++
+		}
+	}
+
+	if first == 0 {
+		return runs
+	}
+
+	// Copy rather than reslice, so the discarded runs can be garbage collected.
+	return append([]domain.Run{}, runs[first:]...)
+}
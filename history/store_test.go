@@ -0,0 +1,78 @@
+package history_test
+
+import (
+	"time"
+
+	"github.com/prodda/prodda/domain"
+	"github.com/prodda/prodda/history"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("InMemoryStore", func() {
+	runAt := func(taskID uint, startTime time.Time) domain.Run {
+		return domain.Run{
+			TaskID:    taskID,
+			StartTime: startTime,
+			EndTime:   startTime.Add(time.Second),
+			Outcome:   domain.RunSucceeded,
+		}
+	}
+
+	It("returns no runs for tasks which have not run", func() {
+		s := history.NewInMemoryStore(0, 0)
+		runs, total, err := s.ByTaskID(1, 0, 10)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(runs).To(HaveLen(0))
+		Expect(total).To(Equal(0))
+	})
+
+	It("returns pages of runs for a task, most recent first", func() {
+		s := history.NewInMemoryStore(0, 0)
+		now := time.Now()
+		for i := 0; i < 5; i++ {
+			s.RecordRun(runAt(1, now.Add(time.Duration(i)*time.Minute)))
+		}
+		s.RecordRun(runAt(2, now))
+
+		runs, total, err := s.ByTaskID(1, 1, 2)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(total).To(Equal(5))
+		Expect(runs).To(HaveLen(2))
+		Expect(runs[0].StartTime).To(Equal(now.Add(3 * time.Minute)))
+		Expect(runs[1].StartTime).To(Equal(now.Add(2 * time.Minute)))
+
+		runs, _, err = s.ByTaskID(1, 4, 10)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(runs).To(HaveLen(1))
+
+		runs, _, err = s.ByTaskID(1, 10, 10)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(runs).To(HaveLen(0))
+	})
+
+	It("retains at most the maximum number of runs per task", func() {
+		s := history.NewInMemoryStore(3, 0)
+		now := time.Now()
+		for i := 0; i < 5; i++ {
+			s.RecordRun(runAt(1, now.Add(time.Duration(i)*time.Minute)))
+		}
+
+		runs, total, err := s.ByTaskID(1, 0, 10)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(total).To(Equal(3))
+		Expect(runs[2].StartTime).To(Equal(now.Add(2 * time.Minute)))
+	})
+
+	It("discards runs older than the maximum age", func() {
+		s := history.NewInMemoryStore(0, time.Hour)
+		now := time.Now()
+		s.RecordRun(runAt(1, now.Add(-2*time.Hour)))
+		s.RecordRun(runAt(1, now))
+
+		runs, total, err := s.ByTaskID(1, 0, 10)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(total).To(Equal(1))
+		Expect(runs[0].StartTime).To(Equal(now))
+	})
+})
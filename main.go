@@ -1,18 +1,34 @@
 package main
 
 import (
+	"database/sql"
+	"fmt"
 	"os"
 	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/prodda/prodda/api"
+	"github.com/prodda/prodda/domain"
+	"github.com/prodda/prodda/history"
 	"github.com/prodda/prodda/registry"
 	"github.com/prodda/prodda/schedule"
 	"github.com/pivotal-golang/lager"
 	"github.com/tedsuo/ifrit"
 	"github.com/tedsuo/ifrit/grouper"
+	"github.com/tedsuo/ifrit/sigmon"
+	_ "github.com/mattn/go-sqlite3"
 	"gopkg.in/robfig/cron.v2"
 )
 
+const (
+	defaultShutdownGracePeriod  = 30 * time.Second
+	defaultRegistrySyncInterval = 10 * time.Second
+
+	// registrySQLDriver is the only database/sql driver linked into prodda.
+	registrySQLDriver = "sqlite3"
+)
+
 var (
 	username string
 	password string
@@ -34,26 +50,226 @@ func main() {
 	password = os.Getenv("PASSWORD")
 
 	logger.Info("Initializing registry")
-	taskRegistry := registry.NewInMemoryTaskRegistry()
+	taskRegistry, lease, err := newTaskRegistry(logger)
+	if err != nil {
+		logger.Fatal("Cannot initialize registry", err, lager.Data{"REGISTRY_TYPE": os.Getenv("REGISTRY_TYPE")})
+	}
 	logger.Info("Initializing registry complete")
 
+	historyStore, err := newHistoryStore()
+	if err != nil {
+		logger.Fatal("Cannot initialize history", err)
+	}
+
+	minimumInterval, err := minimumTaskInterval()
+	if err != nil {
+		logger.Fatal("Cannot parse minimum task frequency", err, lager.Data{"MINIMUM_TASK_FREQUENCY": os.Getenv("MINIMUM_TASK_FREQUENCY")})
+	}
+
+	defaultTimezone := os.Getenv("DEFAULT_TIMEZONE")
+	err = domain.ValidateTimezone(defaultTimezone)
+	if err != nil {
+		logger.Fatal("Cannot load default timezone", err, lager.Data{"DEFAULT_TIMEZONE": defaultTimezone})
+	}
+
+	travisEndpoint := os.Getenv("TRAVIS_ENDPOINT")
+	if travisEndpoint != "" {
+		err = domain.SetDefaultTravisEndpoint(travisEndpoint)
+		if err != nil {
+			logger.Fatal("Cannot set default travis endpoint", err, lager.Data{"TRAVIS_ENDPOINT": travisEndpoint})
+		}
+	}
+
+	gitHubEndpoint := os.Getenv("GITHUB_ENDPOINT")
+	if gitHubEndpoint != "" {
+		err = domain.SetDefaultGitHubEndpoint(gitHubEndpoint)
+		if err != nil {
+			logger.Fatal("Cannot set default github endpoint", err, lager.Data{"GITHUB_ENDPOINT": gitHubEndpoint})
+		}
+	}
+
+	shutdownGrace, err := shutdownGracePeriod()
+	if err != nil {
+		logger.Fatal("Cannot parse shutdown grace period", err, lager.Data{"SHUTDOWN_GRACE_PERIOD": os.Getenv("SHUTDOWN_GRACE_PERIOD")})
+	}
+
 	c := cron.New()
+	executor := schedule.NewExecutor(historyStore, logger)
+	scheduler := schedule.NewScheduler(c, taskRegistry, executor, minimumInterval, defaultTimezone, logger)
+	err = scheduler.ScheduleExisting()
+	if err != nil {
+		logger.Fatal("Cannot schedule existing tasks", err)
+	}
+
+	if lease != nil {
+		syncInterval, err := registrySyncInterval()
+		if err != nil {
+			logger.Fatal("Cannot parse registry sync interval", err, lager.Data{"REGISTRY_SYNC_INTERVAL": os.Getenv("REGISTRY_SYNC_INTERVAL")})
+		}
+
+		err = scheduler.Share(lease, syncInterval)
+		if err != nil {
+			logger.Fatal("Cannot sync with shared registry", err)
+		}
+	}
+
 	handler := api.NewHandler(
 		logger,
 		username,
 		password,
 		taskRegistry,
-		c)
+		scheduler,
+		executor,
+		historyStore)
 
 	group := grouper.NewParallel(os.Kill, grouper.Members{
-		grouper.Member{"schedule", schedule.NewRunner(c, logger)},
-		grouper.Member{"api", api.NewRunner(port, handler, logger)},
+		grouper.Member{"schedule", schedule.NewRunner(c, executor, shutdownGrace, logger)},
+		grouper.Member{"api", api.NewRunner(port, handler, shutdownGrace, logger)},
 	})
-	process := ifrit.Invoke(group)
+	process := ifrit.Invoke(sigmon.New(group, syscall.SIGTERM, os.Interrupt))
 
 	logger.Info("Prodda started")
 	err = <-process.Wait()
+	if trace, ok := err.(grouper.ErrorTrace); ok && len(trace) == 0 {
+		// The group returns an empty, but non-nil, trace when every member
+		// exits cleanly.
+		err = nil
+	}
 	if err != nil {
 		logger.Fatal("Error running prodda", err)
 	}
 }
+
+// newTaskRegistry also returns the lease which elects the instance which runs
+// scheduled tasks, for registries which may be shared by several instances.
+func newTaskRegistry(logger lager.Logger) (registry.TaskRegistry, schedule.Lease, error) {
+	registryType := os.Getenv("REGISTRY_TYPE")
+
+	idGenerator, err := newIDGenerator(registryType)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch registryType {
+	case "", "memory":
+		return registry.NewInMemoryTaskRegistry(idGenerator), nil, nil
+	case "file":
+		path := os.Getenv("REGISTRY_FILE_PATH")
+		if path == "" {
+			return nil, nil, fmt.Errorf("REGISTRY_FILE_PATH must be provided for registry type: %s", registryType)
+		}
+		fileRegistry, err := registry.NewFileTaskRegistry(path, idGenerator, logger)
+		return fileRegistry, nil, err
+	case "sql":
+		return newSQLTaskRegistry(idGenerator, logger)
+	default:
+		return nil, nil, fmt.Errorf("Unrecognized registry type: %s", registryType)
+	}
+}
+
+func newHistoryStore() (history.Store, error) {
+	maxRuns := 100
+	maxRunsEnv := os.Getenv("HISTORY_MAX_RUNS_PER_TASK")
+	if maxRunsEnv != "" {
+		var err error
+		maxRuns, err = strconv.Atoi(maxRunsEnv)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var maxAge time.Duration
+	maxAgeEnv := os.Getenv("HISTORY_MAX_AGE")
+	if maxAgeEnv != "" {
+		var err error
+		maxAge, err = time.ParseDuration(maxAgeEnv)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return history.NewInMemoryStore(maxRuns, maxAge), nil
+}
+
+func minimumTaskInterval() (time.Duration, error) {
+	minimumEnv := os.Getenv("MINIMUM_TASK_FREQUENCY")
+	if minimumEnv == "" {
+		return domain.MinimumTaskFrequency, nil
+	}
+	return time.ParseDuration(minimumEnv)
+}
+
+func shutdownGracePeriod() (time.Duration, error) {
+	graceEnv := os.Getenv("SHUTDOWN_GRACE_PERIOD")
+	if graceEnv == "" {
+		return defaultShutdownGracePeriod, nil
+	}
+	return time.ParseDuration(graceEnv)
+}
+
+// newIDGenerator defaults to time-ordered IDs for the sql registry, since
+// instances sharing its database would otherwise compete for the same
+// sequential IDs.
+func newIDGenerator(registryType string) (registry.IDGenerator, error) {
+	generatorType := os.Getenv("TASK_ID_GENERATOR")
+	if generatorType == "" && registryType == "sql" {
+		generatorType = "time-ordered"
+	}
+
+	switch generatorType {
+	case "", "sequential":
+		return registry.NewSequentialIDGenerator(), nil
+	case "random":
+		return registry.NewRandomIDGenerator(), nil
+	case "time-ordered":
+		return registry.NewTimeOrderedIDGenerator(), nil
+	default:
+		return nil, fmt.Errorf("Unrecognized task ID generator: %s", generatorType)
+	}
+}
+
+func newSQLTaskRegistry(idGenerator registry.IDGenerator, logger lager.Logger) (registry.TaskRegistry, schedule.Lease, error) {
+	dataSource := os.Getenv("REGISTRY_SQL_DATASOURCE")
+	if dataSource == "" {
+		return nil, nil, fmt.Errorf("REGISTRY_SQL_DATASOURCE must be provided for registry type: sql")
+	}
+
+	db, err := sql.Open(registrySQLDriver, dataSource)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	logger.Info("Migrating registry database")
+	err = registry.MigrateSQL(db)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lease, err := registry.NewSQLLease(db)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sqlRegistry, err := registry.NewSQLTaskRegistry(db, idGenerator, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sqlRegistry, lease, nil
+}
+
+func registrySyncInterval() (time.Duration, error) {
+	intervalEnv := os.Getenv("REGISTRY_SYNC_INTERVAL")
+	if intervalEnv == "" {
+		return defaultRegistrySyncInterval, nil
+	}
+
+	interval, err := time.ParseDuration(intervalEnv)
+	if err != nil {
+		return 0, err
+	}
+
+	if interval < time.Second {
+		return 0, fmt.Errorf("Registry sync interval must be at least 1s")
+	}
+	return interval, nil
+}
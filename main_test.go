@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/exec"
 	"strconv"
+	"syscall"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -83,3 +84,35 @@ var _ = Describe("Routing", func() {
 		})
 	})
 })
+
+var _ = Describe("Shutdown", func() {
+	var session *gexec.Session
+
+	BeforeEach(func() {
+		os.Setenv("PORT", strconv.Itoa(appPort))
+		os.Setenv("USERNAME", username)
+		os.Setenv("PASSWORD", password)
+
+		command := exec.Command(pathToExecutable)
+		var err error
+		session, err = gexec.Start(command, GinkgoWriter, GinkgoWriter)
+		Expect(err).ShouldNot(HaveOccurred())
+		Eventually(session.Out).Should(gbytes.Say("Prodda started"))
+	})
+
+	AfterEach(func() {
+		session.Kill().Wait()
+	})
+
+	for _, sig := range []os.Signal{syscall.SIGTERM, os.Interrupt} {
+		It(fmt.Sprintf("drains the scheduler and API and exits cleanly on %s", sig), func(sig os.Signal) func() {
+			return func() {
+				session.Signal(sig)
+
+				Eventually(session.Out).Should(gbytes.Say("Scheduler stopped"))
+				Eventually(session.Out).Should(gbytes.Say("API requests completed"))
+				Eventually(session).Should(gexec.Exit(0))
+			}
+		}(sig))
+	}
+})
@@ -0,0 +1,323 @@
+package registry
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/prodda/prodda/domain"
+	"github.com/pivotal-golang/lager"
+)
+
+const (
+	journalOpPut    = "put"
+	journalOpRemove = "remove"
+
+	// minCompactJournalSize is the size in bytes below which the journal is
+	// only compacted on startup.
+	minCompactJournalSize = 1024 * 1024
+)
+
+// FileTaskRegistry keeps tasks in memory and records every change in an
+// append-only journal file, from which the tasks are restored on creation.
+// The journal is compacted on creation, and whenever it has grown to twice
+// its size when last compacted, once it is at least minCompactJournalSize.
+type FileTaskRegistry struct {
+	persistentTaskRegistry
+	path   string
+	file   *os.File
+	logger lager.Logger
+
+	// size is the size of the journal, and compactedSize its size when last
+	// compacted. They are guarded by the mutex.
+	size          int64
+	compactedSize int64
+
+	// greatestID is the greatest ID ever journaled, which is kept in the
+	// journal when it is compacted, so that the IDs of removed tasks are
+	// not reused. It is guarded by the mutex.
+	greatestID uint
+}
+
+type journalEntry struct {
+	Op   string          `json:"op"`
+	ID   uint            `json:"id"`
+	Task json.RawMessage `json:"task,omitempty"`
+}
+
+// NewFileTaskRegistry restores any tasks previously journaled at path,
+// compacts the journal and opens it for further changes.
+// The journal file is created if it does not exist.
+func NewFileTaskRegistry(path string, idGenerator IDGenerator, logger lager.Logger) (*FileTaskRegistry, error) {
+	r := &FileTaskRegistry{
+		path:   path,
+		logger: logger,
+	}
+	r.tasks = newInMemoryTaskRegistry(idGenerator)
+	r.store = r
+
+	entries, greatestID, err := readJournal(path, logger)
+	if err != nil {
+		return nil, err
+	}
+	r.greatestID = greatestID
+	r.tasks.observe(greatestID)
+
+	for _, entry := range entries {
+		task, err := domain.DecodeTask(entry.Task, logger)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to restore task %d from %s: %v", entry.ID, path, err)
+		}
+
+		err = task.SetID(entry.ID)
+		if err != nil {
+			return nil, err
+		}
+		r.tasks.insert(task)
+	}
+
+	err = r.compact()
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// readJournal replays the journal at path, returning the latest put entry for
+// every task which has not been removed, in the order they were first added,
+// and the greatest ID of any entry. A last entry which is damaged and lacks
+// its newline was only partly written, e.g. because prodda crashed, and is
+// discarded; it is cut off when the journal is then compacted. Any other
+// damaged entry is an error.
+func readJournal(path string, logger lager.Logger) ([]journalEntry, uint, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	order := []uint{}
+	current := map[uint]journalEntry{}
+	var greatestID uint
+
+	reader := bufio.NewReader(f)
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return nil, 0, readErr
+		}
+
+		partial := readErr == io.EOF
+		line = bytes.TrimSuffix(line, []byte("\n"))
+		if len(line) == 0 {
+			if partial {
+				break
+			}
+			continue
+		}
+
+		var entry journalEntry
+		err := json.Unmarshal(line, &entry)
+		if err != nil && partial {
+			logger.Info("Discarding partly written journal entry", lager.Data{"path": path, "err": err.Error()})
+			break
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("Corrupt journal entry in %s: %v", path, err)
+		}
+
+		if entry.ID > greatestID {
+			greatestID = entry.ID
+		}
+
+		switch entry.Op {
+		case journalOpPut:
+			if _, ok := current[entry.ID]; !ok {
+				order = append(order, entry.ID)
+			}
+			current[entry.ID] = entry
+		case journalOpRemove:
+			delete(current, entry.ID)
+		default:
+			return nil, 0, fmt.Errorf("Unrecognized journal operation in %s: %s", path, entry.Op)
+		}
+
+		if partial {
+			break
+		}
+	}
+
+	entries := []journalEntry{}
+	for _, id := range order {
+		if entry, ok := current[id]; ok {
+			entries = append(entries, entry)
+			delete(current, id)
+		}
+	}
+	return entries, greatestID, nil
+}
+
+// compact rewrites the journal so that it contains a single entry per task,
+// and a remove entry for the greatest ID ever journaled if no task has it any
+// longer, and opens it for further changes. The new journal is written
+// alongside the old one and renamed over it, so a failure part way through
+// leaves the old journal intact and open.
+func (r *FileTaskRegistry) compact() error {
+	allTasks, err := r.tasks.All()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.OpenFile(
+		filepath.Join(filepath.Dir(r.path), "."+filepath.Base(r.path)+".tmp"),
+		os.O_WRONLY|os.O_CREATE|os.O_TRUNC|os.O_APPEND,
+		0600)
+	if err != nil {
+		return err
+	}
+
+	for _, task := range allTasks {
+		_, err = writeJournalEntry(tmp, journalOpPut, task)
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return err
+		}
+	}
+
+	if r.greatestID > 0 && (len(allTasks) == 0 || allTasks[len(allTasks)-1].ID() < r.greatestID) {
+		_, err = appendJournalEntry(tmp, journalEntry{Op: journalOpRemove, ID: r.greatestID})
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return err
+		}
+	}
+
+	err = tmp.Sync()
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	info, err := tmp.Stat()
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	err = os.Rename(tmp.Name(), r.path)
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if r.file != nil {
+		r.file.Close()
+	}
+	r.file = tmp
+	r.size = info.Size()
+	r.compactedSize = info.Size()
+	return nil
+}
+
+// compactIfGrown compacts the journal once it has grown to twice its size
+// when last compacted, and to at least minCompactJournalSize, so that it
+// does not grow without bound between restarts. Failures are logged rather
+// than returned, since the change has already been journaled.
+func (r *FileTaskRegistry) compactIfGrown() {
+	if r.size < minCompactJournalSize || r.size < 2*r.compactedSize {
+		return
+	}
+
+	err := r.compact()
+	if err != nil {
+		r.logger.Error("Failed to compact journal", err, lager.Data{"path": r.path})
+	}
+}
+
+func writeJournalEntry(f *os.File, op string, task domain.Task) (int, error) {
+	entry := journalEntry{
+		Op: op,
+		ID: task.ID(),
+	}
+
+	if op == journalOpPut {
+		record, err := domain.EncodeTask(task)
+		if err != nil {
+			return 0, err
+		}
+		entry.Task = record
+	}
+
+	return appendJournalEntry(f, entry)
+}
+
+// appendJournalEntry returns the number of bytes written.
+func appendJournalEntry(f *os.File, entry journalEntry) (int, error) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return 0, err
+	}
+
+	return f.Write(append(line, '\n'))
+}
+
+func (r *FileTaskRegistry) insert(task domain.Task) error {
+	err := r.journal(journalOpPut, task)
+	if err != nil {
+		return err
+	}
+
+	if task.ID() > r.greatestID {
+		r.greatestID = task.ID()
+	}
+
+	r.compactIfGrown()
+	return nil
+}
+
+func (r *FileTaskRegistry) update(task domain.Task) error {
+	err := r.journal(journalOpPut, task)
+	if err != nil {
+		return err
+	}
+
+	r.compactIfGrown()
+	return nil
+}
+
+func (r *FileTaskRegistry) remove(task domain.Task) error {
+	err := r.journal(journalOpRemove, task)
+	if err != nil {
+		return err
+	}
+
+	r.compactIfGrown()
+	return nil
+}
+
+func (r *FileTaskRegistry) journal(op string, task domain.Task) error {
+	n, err := writeJournalEntry(r.file, op, task)
+	r.size += int64(n)
+	if err != nil {
+		return err
+	}
+	return r.file.Sync()
+}
+
+// Close closes the underlying journal file.
+func (r *FileTaskRegistry) Close() error {
+	return r.file.Close()
+}
@@ -0,0 +1,289 @@
+package registry_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prodda/prodda/domain"
+	"github.com/prodda/prodda/registry"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+)
+
+var _ = Describe("FileTaskRegistry", func() {
+	var (
+		dir    string
+		path   string
+		logger *lagertest.TestLogger
+		r      *registry.FileTaskRegistry
+	)
+
+	reopen := func() {
+		err := r.Close()
+		Expect(err).NotTo(HaveOccurred())
+
+		r, err = registry.NewFileTaskRegistry(path, registry.NewSequentialIDGenerator(), logger)
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "prodda-registry")
+		Expect(err).NotTo(HaveOccurred())
+		path = filepath.Join(dir, "tasks.journal")
+		logger = lagertest.NewTestLogger("FileTaskRegistry Test")
+
+		r, err = registry.NewFileTaskRegistry(path, registry.NewSequentialIDGenerator(), logger)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		r.Close()
+		os.RemoveAll(dir)
+	})
+
+	It("is empty when the journal does not exist", func() {
+		allTasks, err := r.All()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(allTasks).To(HaveLen(0))
+	})
+
+	It("restores added tasks, including secrets", func() {
+		travisTask := domain.NewTravisTask("@daily", "", "some-token", 1234, logger)
+		err := r.Add(travisTask)
+		Expect(err).NotTo(HaveOccurred())
+
+		noOpTask := domain.NewNoOpTask("@hourly", 5*time.Second, logger)
+		err = r.Add(noOpTask)
+		Expect(err).NotTo(HaveOccurred())
+
+		reopen()
+
+		allTasks, err := r.All()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(allTasks).To(HaveLen(2))
+		Expect(allTasks[0].AsJSON()).To(Equal(travisTask.AsJSON()))
+		Expect(allTasks[1].AsJSON()).To(Equal(noOpTask.AsJSON()))
+
+		restored, err := domain.EncodeTask(allTasks[0])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(restored)).To(ContainSubstring("some-token"))
+	})
+
+	It("restores updated tasks", func() {
+		task := domain.NewURLGetTask("@daily", "http://localhost/", logger)
+		err := r.Add(task)
+		Expect(err).NotTo(HaveOccurred())
+
+		task.SetSchedule("@hourly")
+		_, err = r.Update(task)
+		Expect(err).NotTo(HaveOccurred())
+
+		reopen()
+
+		restored, err := r.ByID(task.ID())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(restored).NotTo(BeNil())
+		Expect(restored.Schedule()).To(Equal("@hourly"))
+	})
+
+	It("does not restore removed tasks", func() {
+		task := domain.NewURLGetTask("@daily", "http://localhost/", logger)
+		err := r.Add(task)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = r.Remove(task)
+		Expect(err).NotTo(HaveOccurred())
+
+		reopen()
+
+		allTasks, err := r.All()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(allTasks).To(HaveLen(0))
+	})
+
+	It("undoes updates and removals which cannot be journaled", func() {
+		task := domain.NewURLGetTask("@daily", "http://localhost/", logger)
+		err := r.Add(task)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = r.Close()
+		Expect(err).NotTo(HaveOccurred())
+
+		replacement := domain.NewURLGetTask("@hourly", "http://localhost/", logger)
+		replacement.SetID(task.ID())
+		_, err = r.Update(replacement)
+		Expect(err).To(HaveOccurred())
+
+		current, err := r.ByID(task.ID())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(current).To(Equal(task))
+
+		err = r.Remove(task)
+		Expect(err).To(HaveOccurred())
+
+		current, err = r.ByID(task.ID())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(current).To(Equal(task))
+	})
+
+	It("returns an error when the journal is corrupt", func() {
+		err := ioutil.WriteFile(path, []byte("not json\n"), 0600)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = registry.NewFileTaskRegistry(path, registry.NewSequentialIDGenerator(), logger)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("returns an error when an entry before the last is corrupt", func() {
+		task := domain.NewURLGetTask("@daily", "http://localhost/", logger)
+		err := r.Add(task)
+		Expect(err).NotTo(HaveOccurred())
+		err = r.Close()
+		Expect(err).NotTo(HaveOccurred())
+
+		journal, err := ioutil.ReadFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		err = ioutil.WriteFile(path, append([]byte("{\"op\":\"put\",\n"), journal...), 0600)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = registry.NewFileTaskRegistry(path, registry.NewSequentialIDGenerator(), logger)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("discards a partly written last entry", func() {
+		task := domain.NewURLGetTask("@daily", "http://localhost/", logger)
+		err := r.Add(task)
+		Expect(err).NotTo(HaveOccurred())
+		err = r.Close()
+		Expect(err).NotTo(HaveOccurred())
+
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = f.Write([]byte(`{"op":"put","id":2,"task":{"sched`))
+		Expect(err).NotTo(HaveOccurred())
+		err = f.Close()
+		Expect(err).NotTo(HaveOccurred())
+
+		r, err = registry.NewFileTaskRegistry(path, registry.NewSequentialIDGenerator(), logger)
+		Expect(err).NotTo(HaveOccurred())
+
+		journal, err := ioutil.ReadFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(journal)).NotTo(ContainSubstring(`"id":2`))
+
+		another := domain.NewURLGetTask("@hourly", "http://localhost/", logger)
+		err = r.Add(another)
+		Expect(err).NotTo(HaveOccurred())
+
+		reopen()
+
+		allTasks, err := r.All()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(allTasks).To(HaveLen(2))
+		Expect(allTasks[0].AsJSON()).To(Equal(task.AsJSON()))
+		Expect(allTasks[1].AsJSON()).To(Equal(another.AsJSON()))
+	})
+
+	It("compacts the journal as it grows", func() {
+		task := domain.NewURLGetTask("@daily", "http://localhost/"+strings.Repeat("a", 64*1024), logger)
+		err := r.Add(task)
+		Expect(err).NotTo(HaveOccurred())
+
+		for i := 0; i < 40; i++ {
+			replacement := domain.NewURLGetTask(fmt.Sprintf("@every %dh", i+1), "http://localhost/"+strings.Repeat("a", 64*1024), logger)
+			replacement.SetID(task.ID())
+			_, err = r.Update(replacement)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		info, err := os.Stat(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Size()).To(BeNumerically("<", 2*1024*1024))
+
+		reopen()
+
+		restored, err := r.ByID(task.ID())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(restored.Schedule()).To(Equal("@every 40h"))
+	})
+
+	It("journals concurrent changes consistently", func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				kept := domain.NewURLGetTask("@daily", "http://localhost/", logger)
+				err := r.Add(kept)
+				Expect(err).NotTo(HaveOccurred())
+
+				kept.SetSchedule(fmt.Sprintf("@every %dm", i+1))
+				_, err = r.Update(kept)
+				Expect(err).NotTo(HaveOccurred())
+
+				removed := domain.NewURLGetTask("@daily", "http://localhost/", logger)
+				err = r.Add(removed)
+				Expect(err).NotTo(HaveOccurred())
+
+				err = r.Remove(removed)
+				Expect(err).NotTo(HaveOccurred())
+			}(i)
+		}
+		wg.Wait()
+
+		before, err := r.All()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(before).To(HaveLen(10))
+
+		reopen()
+
+		for _, task := range before {
+			restored, err := r.ByID(task.ID())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(restored).NotTo(BeNil())
+			Expect(restored.Schedule()).To(Equal(task.Schedule()))
+		}
+	})
+
+	It("does not reuse the IDs of restored tasks", func() {
+		first := domain.NewURLGetTask("@daily", "http://localhost/", logger)
+		err := r.Add(first)
+		Expect(err).NotTo(HaveOccurred())
+
+		reopen()
+
+		second := domain.NewURLGetTask("@daily", "http://localhost/", logger)
+		err = r.Add(second)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(second.ID()).To(BeNumerically(">", first.ID()))
+	})
+	It("does not reuse the IDs of removed tasks", func() {
+		first := domain.NewURLGetTask("@daily", "http://localhost/", logger)
+		err := r.Add(first)
+		Expect(err).NotTo(HaveOccurred())
+
+		second := domain.NewURLGetTask("@daily", "http://localhost/", logger)
+		err = r.Add(second)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = r.Remove(second)
+		Expect(err).NotTo(HaveOccurred())
+
+		reopen()
+		reopen()
+
+		third := domain.NewURLGetTask("@daily", "http://localhost/", logger)
+		err = r.Add(third)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(third.ID()).To(BeNumerically(">", second.ID()))
+	})
+})
@@ -0,0 +1,117 @@
+package registry
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// IDGenerator provides candidate IDs for tasks added to a registry.
+// Registries discard candidates which are zero or already in use,
+// so generators need not guarantee uniqueness themselves.
+// Implementations must be safe for concurrent use.
+type IDGenerator interface {
+	NextID() uint
+
+	// Observe informs the generator of an ID which is in use,
+	// e.g. by a task restored from persistent storage.
+	Observe(id uint)
+}
+
+// SequentialIDGenerator generates monotonically increasing IDs,
+// starting after the greatest ID observed.
+type SequentialIDGenerator struct {
+	mutex sync.Mutex
+	last  uint
+}
+
+func NewSequentialIDGenerator() *SequentialIDGenerator {
+	return &SequentialIDGenerator{}
+}
+
+func (g *SequentialIDGenerator) NextID() uint {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.last++
+	return g.last
+}
+
+func (g *SequentialIDGenerator) Observe(id uint) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if id > g.last {
+		g.last = id
+	}
+}
+
+// RandomIDGenerator generates random 32-bit IDs from a source seeded
+// at creation, so that IDs are not repeated across restarts.
+type RandomIDGenerator struct {
+	mutex sync.Mutex
+	rand  *rand.Rand
+}
+
+func NewRandomIDGenerator() *RandomIDGenerator {
+	return &RandomIDGenerator{
+		rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (g *RandomIDGenerator) NextID() uint {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	return uint(g.rand.Uint32())
+}
+
+func (g *RandomIDGenerator) Observe(id uint) {}
+
+// timeOrderedEpoch is the start of the timestamps of time-ordered IDs,
+// chosen so that IDs fit in the 53 bits of integer precision of a JSON
+// number in JavaScript clients until 2084.
+var timeOrderedEpoch = time.Date(2015, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// timeOrderedRandomBits is the number of random low bits of time-ordered IDs.
+const timeOrderedRandomBits = 12
+
+// TimeOrderedIDGenerator generates IDs which, like ULIDs, combine the current
+// time in milliseconds with random bits, so that IDs increase with creation
+// time and generators which do not coordinate, e.g. in several instances
+// sharing a registry, are unlikely to generate the same ID. IDs generated
+// within the same millisecond by one generator still increase.
+type TimeOrderedIDGenerator struct {
+	mutex sync.Mutex
+	rand  *rand.Rand
+	last  uint
+}
+
+func NewTimeOrderedIDGenerator() *TimeOrderedIDGenerator {
+	return &TimeOrderedIDGenerator{
+		rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (g *TimeOrderedIDGenerator) NextID() uint {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	millis := uint(time.Since(timeOrderedEpoch) / time.Millisecond)
+	id := millis<<timeOrderedRandomBits | uint(g.rand.Intn(1<<timeOrderedRandomBits))
+	if id <= g.last {
+		id = g.last + 1
+	}
+
+	g.last = id
+	return id
+}
+
+func (g *TimeOrderedIDGenerator) Observe(id uint) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if id > g.last {
+		g.last = id
+	}
+}
@@ -0,0 +1,116 @@
+package registry_test
+
+import (
+	"time"
+
+	"github.com/prodda/prodda/domain"
+	"github.com/prodda/prodda/registry"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("IDGenerator", func() {
+	Describe("SequentialIDGenerator", func() {
+		It("generates increasing IDs starting from one", func() {
+			g := registry.NewSequentialIDGenerator()
+			Expect(g.NextID()).To(Equal(uint(1)))
+			Expect(g.NextID()).To(Equal(uint(2)))
+			Expect(g.NextID()).To(Equal(uint(3)))
+		})
+
+		It("continues after the greatest observed ID", func() {
+			g := registry.NewSequentialIDGenerator()
+			g.Observe(10)
+			g.Observe(5)
+			Expect(g.NextID()).To(Equal(uint(11)))
+		})
+	})
+
+	Describe("TimeOrderedIDGenerator", func() {
+		It("generates increasing IDs", func() {
+			g := registry.NewTimeOrderedIDGenerator()
+
+			previous := g.NextID()
+			for i := 0; i < 100; i++ {
+				next := g.NextID()
+				Expect(next).To(BeNumerically(">", previous))
+				previous = next
+			}
+		})
+
+		It("generates IDs ordered by creation time across generators", func() {
+			first := registry.NewTimeOrderedIDGenerator().NextID()
+			time.Sleep(2 * time.Millisecond)
+			second := registry.NewTimeOrderedIDGenerator().NextID()
+
+			Expect(second).To(BeNumerically(">", first))
+			Expect(second).To(BeNumerically("<", uint(1)<<53))
+		})
+
+		It("continues after the greatest observed ID", func() {
+			g := registry.NewTimeOrderedIDGenerator()
+			future := g.NextID() + 1<<40
+			g.Observe(future)
+			Expect(g.NextID()).To(Equal(future + 1))
+		})
+	})
+
+	Describe("RandomIDGenerator", func() {
+		It("does not repeat the sequence of another generator", func() {
+			first := registry.NewRandomIDGenerator()
+			second := registry.NewRandomIDGenerator()
+
+			same := true
+			for i := 0; i < 5; i++ {
+				if first.NextID() != second.NextID() {
+					same = false
+				}
+			}
+			Expect(same).To(BeFalse())
+		})
+	})
+
+	Context("when used by a registry", func() {
+		It("skips IDs which are zero or already in use", func() {
+			r := registry.NewInMemoryTaskRegistry(&repeatingIDGenerator{ids: []uint{0, 1, 1, 2}})
+
+			first := &domain.NoOpTask{}
+			second := &domain.NoOpTask{}
+			err := r.Add(first)
+			Expect(err).NotTo(HaveOccurred())
+			err = r.Add(second)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(first.ID()).To(Equal(uint(1)))
+			Expect(second.ID()).To(Equal(uint(2)))
+		})
+
+		It("returns tasks ordered by ID", func() {
+			r := registry.NewInMemoryTaskRegistry(&repeatingIDGenerator{ids: []uint{30, 10, 20}})
+
+			for i := 0; i < 3; i++ {
+				err := r.Add(&domain.NoOpTask{})
+				Expect(err).NotTo(HaveOccurred())
+			}
+
+			allTasks, err := r.All()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(allTasks).To(HaveLen(3))
+			Expect(allTasks[0].ID()).To(Equal(uint(10)))
+			Expect(allTasks[1].ID()).To(Equal(uint(20)))
+			Expect(allTasks[2].ID()).To(Equal(uint(30)))
+		})
+	})
+})
+
+type repeatingIDGenerator struct {
+	ids []uint
+}
+
+func (g *repeatingIDGenerator) NextID() uint {
+	id := g.ids[0]
+	g.ids = g.ids[1:]
+	return id
+}
+
+func (g *repeatingIDGenerator) Observe(uint) {}
@@ -0,0 +1,106 @@
+package registry
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/prodda/prodda/domain"
+)
+
+// maxIDAttempts limits the IDs tried when adding a task whose ID turns out
+// to be in use in the store, e.g. by another instance sharing it.
+const maxIDAttempts = 10
+
+// errIDInUse is returned by a taskStore which cannot insert a task because
+// its ID is already in use.
+var errIDInUse = errors.New("Task ID already in use")
+
+// taskStore durably records changes to the tasks held by a persistentTaskRegistry.
+type taskStore interface {
+	insert(task domain.Task) error
+	update(task domain.Task) error
+	remove(task domain.Task) error
+}
+
+// persistentTaskRegistry holds tasks in memory, so that the same task
+// instances are returned to all callers, and writes every change through
+// to a taskStore. Changes are serialized, so that they reach the store in the
+// same order as they are made in memory, and are undone in memory if they
+// cannot be stored.
+type persistentTaskRegistry struct {
+	mutex sync.Mutex
+	tasks *InMemoryTaskRegistry
+	store taskStore
+}
+
+func (r *persistentTaskRegistry) All() ([]domain.Task, error) {
+	return r.tasks.All()
+}
+
+func (r *persistentTaskRegistry) Add(task domain.Task) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for attempt := 1; ; attempt++ {
+		err := r.tasks.Add(task)
+		if err != nil {
+			return err
+		}
+
+		err = r.store.insert(task)
+		if err == nil {
+			return nil
+		}
+
+		// Clear the ID, so that another may be assigned on the next
+		// attempt and the task is left as it was if none succeeds.
+		r.tasks.Remove(task)
+		task.SetID(0)
+		if err != errIDInUse || attempt == maxIDAttempts {
+			return err
+		}
+	}
+}
+
+func (r *persistentTaskRegistry) ByID(ID uint) (domain.Task, error) {
+	return r.tasks.ByID(ID)
+}
+
+func (r *persistentTaskRegistry) Update(task domain.Task) (domain.Task, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	previous, err := r.tasks.ByID(task.ID())
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := r.tasks.Update(task)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.store.update(updated)
+	if err != nil {
+		r.tasks.Update(previous)
+		return nil, err
+	}
+	return updated, nil
+}
+
+func (r *persistentTaskRegistry) Remove(task domain.Task) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	err := r.tasks.Remove(task)
+	if err != nil {
+		return err
+	}
+
+	err = r.store.remove(task)
+	if err != nil {
+		r.tasks.insert(task)
+		return err
+	}
+	return nil
+}
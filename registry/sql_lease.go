@@ -0,0 +1,53 @@
+package registry
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"time"
+)
+
+// SQLLease elects one of the prodda instances sharing the database of an
+// SQLTaskRegistry to run scheduled tasks. The lease expires unless it is
+// renewed within its term, so that another instance takes it over if the
+// holder stops. The clocks of the instances must agree to well within the
+// term.
+type SQLLease struct {
+	db     *sql.DB
+	holder string
+}
+
+// NewSQLLease returns a lease held under a random identity, so that each
+// instance is a different holder.
+func NewSQLLease(db *sql.DB) (*SQLLease, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SQLLease{
+		db:     db,
+		holder: hex.EncodeToString(b),
+	}, nil
+}
+
+// Acquire acquires the lease for term if it is free or has expired, or renews
+// it if it is already held, returning whether it is held.
+func (l *SQLLease) Acquire(term time.Duration) (bool, error) {
+	now := time.Now()
+
+	result, err := l.db.Exec(
+		`UPDATE scheduler_lease SET holder = ?, expires_at = ? WHERE id = 1 AND (holder = ? OR expires_at < ?)`,
+		l.holder, now.Add(term).UnixNano(), l.holder, now.UnixNano())
+	if err != nil {
+		return false, err
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return updated == 1, nil
+}
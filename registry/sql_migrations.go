@@ -0,0 +1,101 @@
+package registry
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+type sqlMigration struct {
+	version    int
+	statements []string
+}
+
+// sqlMigrations must only ever be appended to; each migration is applied once,
+// in order of version, and recorded in the schema_migrations table.
+// Statements are written for SQLite, the only database/sql driver linked into
+// prodda; placeholders are not rebound for other drivers.
+var sqlMigrations = []sqlMigration{
+	{
+		version: 1,
+		statements: []string{
+			`CREATE TABLE tasks (
+				id BIGINT NOT NULL PRIMARY KEY,
+				type VARCHAR(255) NOT NULL,
+				data TEXT NOT NULL
+			)`,
+		},
+	},
+	{
+		version: 2,
+		statements: []string{
+			`CREATE TABLE scheduler_lease (
+				id INTEGER NOT NULL PRIMARY KEY,
+				holder VARCHAR(255) NOT NULL,
+				expires_at BIGINT NOT NULL
+			)`,
+			`INSERT INTO scheduler_lease (id, holder, expires_at) VALUES (1, '', 0)`,
+		},
+	},
+	{
+		version: 3,
+		statements: []string{
+			`CREATE TABLE task_ids (
+				id INTEGER NOT NULL PRIMARY KEY,
+				greatest BIGINT NOT NULL
+			)`,
+			`INSERT INTO task_ids (id, greatest) SELECT 1, COALESCE(MAX(id), 0) FROM tasks`,
+		},
+	},
+}
+
+// MigrateSQL brings the schema used by the SQLTaskRegistry up to date,
+// applying each migration which has not yet been applied in its own transaction.
+func MigrateSQL(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER NOT NULL PRIMARY KEY
+	)`)
+	if err != nil {
+		return err
+	}
+
+	var current int
+	err = db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range sqlMigrations {
+		if m.version <= current {
+			continue
+		}
+
+		err = applySQLMigration(db, m)
+		if err != nil {
+			return fmt.Errorf("Failed to apply migration %d: %v", m.version, err)
+		}
+	}
+	return nil
+}
+
+func applySQLMigration(db *sql.DB, m sqlMigration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, statement := range m.statements {
+		_, err = tx.Exec(statement)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`INSERT INTO schema_migrations (version) VALUES (?)`, m.version)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,265 @@
+package registry
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/prodda/prodda/domain"
+	"github.com/pivotal-golang/lager"
+)
+
+// SQLTaskRegistry stores tasks in an SQLite database which may be shared by
+// several prodda instances. Each task is stored as its type and its
+// serialized form, including secrets. The schema must first be brought up to
+// date via MigrateSQL.
+//
+// Tasks are also held in memory, so that the same task instances are returned
+// to all callers, and are brought up to date with the database whenever tasks
+// are listed, looked up or added, so that changes made by other instances are
+// reflected. Such changes are also recorded, so that they can be applied to
+// the schedule; see SharedTaskRegistry. IDs are checked against the database,
+// so instances never assign the same ID to different tasks, and the greatest
+// ID ever assigned is kept, so that the IDs of removed tasks are not reused.
+type SQLTaskRegistry struct {
+	persistentTaskRegistry
+	db     *sql.DB
+	logger lager.Logger
+
+	// stored holds the serialized form of each task last read from or
+	// written to the database, so that tasks changed by other instances
+	// can be recognized. It is guarded by the mutex.
+	stored map[uint]string
+
+	// changes holds the changes made by other instances which have not yet
+	// been returned by Changes. It is guarded by the mutex.
+	changes []TaskChange
+}
+
+// NewSQLTaskRegistry restores all tasks stored in the database.
+func NewSQLTaskRegistry(db *sql.DB, idGenerator IDGenerator, logger lager.Logger) (*SQLTaskRegistry, error) {
+	r := &SQLTaskRegistry{
+		db:     db,
+		logger: logger,
+		stored: map[uint]string{},
+	}
+	r.tasks = newInMemoryTaskRegistry(idGenerator)
+	r.store = r
+
+	err := r.sync()
+	if err != nil {
+		return nil, err
+	}
+
+	// The tasks restored are not changes.
+	r.changes = nil
+
+	return r, nil
+}
+
+// Sync brings the tasks held in memory up to date with the database.
+func (r *SQLTaskRegistry) Sync() error {
+	return r.sync()
+}
+
+// Changes returns the changes made by other instances found since Changes
+// was last called.
+func (r *SQLTaskRegistry) Changes() []TaskChange {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	changes := r.changes
+	r.changes = nil
+	return changes
+}
+
+func (r *SQLTaskRegistry) All() ([]domain.Task, error) {
+	err := r.sync()
+	if err != nil {
+		return nil, err
+	}
+	return r.persistentTaskRegistry.All()
+}
+
+func (r *SQLTaskRegistry) ByID(ID uint) (domain.Task, error) {
+	err := r.sync()
+	if err != nil {
+		return nil, err
+	}
+	return r.persistentTaskRegistry.ByID(ID)
+}
+
+// Add syncs with the database before assigning an ID, so that the IDs of
+// tasks added by other instances are known to the ID generator.
+func (r *SQLTaskRegistry) Add(task domain.Task) error {
+	err := r.sync()
+	if err != nil {
+		return err
+	}
+	return r.persistentTaskRegistry.Add(task)
+}
+
+// sync brings the tasks held in memory up to date with the database,
+// recording the changes it finds. Tasks changed by other instances are
+// replaced by new instances, so the instances they replace can still be
+// unscheduled.
+func (r *SQLTaskRegistry) sync() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var greatestID uint
+	err := r.db.QueryRow(`SELECT greatest FROM task_ids WHERE id = 1`).Scan(&greatestID)
+	if err != nil {
+		return err
+	}
+	r.tasks.observe(greatestID)
+
+	rows, err := r.db.Query(`SELECT id, data FROM tasks ORDER BY id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	found := map[uint]bool{}
+	for rows.Next() {
+		var id uint
+		var data string
+		err = rows.Scan(&id, &data)
+		if err != nil {
+			return err
+		}
+
+		found[id] = true
+		if stored, ok := r.stored[id]; ok && stored == data {
+			continue
+		}
+
+		task, err := domain.DecodeTask([]byte(data), r.logger)
+		if err != nil {
+			return fmt.Errorf("Failed to restore task %d: %v", id, err)
+		}
+
+		err = task.SetID(id)
+		if err != nil {
+			return err
+		}
+
+		existing, err := r.tasks.ByID(id)
+		if err != nil {
+			return err
+		}
+
+		if existing == nil {
+			r.tasks.insert(task)
+		} else {
+			r.tasks.Update(task)
+		}
+		r.stored[id] = data
+		r.changes = append(r.changes, TaskChange{Previous: existing, Current: task})
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return err
+	}
+
+	allTasks, err := r.tasks.All()
+	if err != nil {
+		return err
+	}
+
+	for _, task := range allTasks {
+		if !found[task.ID()] {
+			r.tasks.Remove(task)
+			delete(r.stored, task.ID())
+			r.changes = append(r.changes, TaskChange{Previous: task})
+		}
+	}
+	return nil
+}
+
+// insert returns errIDInUse if a task with the same ID is already stored.
+func (r *SQLTaskRegistry) insert(task domain.Task) error {
+	data, err := domain.EncodeTask(task)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var count int
+	err = tx.QueryRow(`SELECT COUNT(*) FROM tasks WHERE id = ?`, task.ID()).Scan(&count)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if count > 0 {
+		tx.Rollback()
+		return errIDInUse
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO tasks (id, type, data) VALUES (?, ?, ?)`,
+		task.ID(), task.Type(), string(data))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(
+		`UPDATE task_ids SET greatest = ? WHERE id = 1 AND greatest < ?`,
+		task.ID(), task.ID())
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	r.stored[task.ID()] = string(data)
+	return nil
+}
+
+// update returns an error if the task is no longer stored, e.g. because
+// another instance has removed it.
+func (r *SQLTaskRegistry) update(task domain.Task) error {
+	data, err := domain.EncodeTask(task)
+	if err != nil {
+		return err
+	}
+
+	result, err := r.db.Exec(
+		`UPDATE tasks SET type = ?, data = ? WHERE id = ?`,
+		task.Type(), string(data), task.ID())
+	if err != nil {
+		return err
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if updated == 0 {
+		return fmt.Errorf("Task not found for ID: %d", task.ID())
+	}
+
+	r.stored[task.ID()] = string(data)
+	return nil
+}
+
+func (r *SQLTaskRegistry) remove(task domain.Task) error {
+	_, err := r.db.Exec(`DELETE FROM tasks WHERE id = ?`, task.ID())
+	if err != nil {
+		return err
+	}
+
+	delete(r.stored, task.ID())
+	return nil
+}
@@ -0,0 +1,334 @@
+package registry_test
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/prodda/prodda/domain"
+	"github.com/prodda/prodda/registry"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var _ = Describe("SQLTaskRegistry", func() {
+	var (
+		dir    string
+		path   string
+		db     *sql.DB
+		logger *lagertest.TestLogger
+		r      *registry.SQLTaskRegistry
+	)
+
+	open := func() {
+		var err error
+		db, err = sql.Open("sqlite3", path)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = registry.MigrateSQL(db)
+		Expect(err).NotTo(HaveOccurred())
+
+		r, err = registry.NewSQLTaskRegistry(db, registry.NewSequentialIDGenerator(), logger)
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	reopen := func() {
+		err := db.Close()
+		Expect(err).NotTo(HaveOccurred())
+		open()
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "prodda-registry")
+		Expect(err).NotTo(HaveOccurred())
+		path = filepath.Join(dir, "tasks.db")
+		logger = lagertest.NewTestLogger("SQLTaskRegistry Test")
+
+		open()
+	})
+
+	AfterEach(func() {
+		db.Close()
+		os.RemoveAll(dir)
+	})
+
+	It("is empty on initialization", func() {
+		allTasks, err := r.All()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(allTasks).To(HaveLen(0))
+	})
+
+	It("applies migrations only once", func() {
+		var before int
+		err := db.QueryRow(`SELECT COUNT(*) FROM schema_migrations`).Scan(&before)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = registry.MigrateSQL(db)
+		Expect(err).NotTo(HaveOccurred())
+
+		var after int
+		err = db.QueryRow(`SELECT COUNT(*) FROM schema_migrations`).Scan(&after)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(after).To(Equal(before))
+	})
+
+	It("round-trips every task type, including secrets", func() {
+		tasks := []domain.Task{
+			domain.NewTravisTask("@daily", "", "some-token", 1234, logger),
+			domain.NewURLGetTask("@hourly", "http://localhost/", logger),
+			domain.NewNoOpTask("@midnight", 5*time.Second, logger),
+		}
+
+		for _, task := range tasks {
+			err := r.Add(task)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		reopen()
+
+		for _, task := range tasks {
+			restored, err := r.ByID(task.ID())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(restored).NotTo(BeNil())
+			Expect(restored.AsJSON()).To(Equal(task.AsJSON()))
+		}
+
+		var data string
+		err := db.QueryRow(`SELECT data FROM tasks WHERE type = ?`, domain.TravisTaskType).Scan(&data)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(ContainSubstring("some-token"))
+	})
+
+	It("stores updates", func() {
+		task := domain.NewURLGetTask("@daily", "http://localhost/", logger)
+		err := r.Add(task)
+		Expect(err).NotTo(HaveOccurred())
+
+		task.SetSchedule("@hourly")
+		_, err = r.Update(task)
+		Expect(err).NotTo(HaveOccurred())
+
+		reopen()
+
+		restored, err := r.ByID(task.ID())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(restored).NotTo(BeNil())
+		Expect(restored.Schedule()).To(Equal("@hourly"))
+	})
+
+	It("does not reuse the IDs of removed tasks", func() {
+		first := domain.NewURLGetTask("@daily", "http://localhost/", logger)
+		err := r.Add(first)
+		Expect(err).NotTo(HaveOccurred())
+
+		second := domain.NewURLGetTask("@daily", "http://localhost/", logger)
+		err = r.Add(second)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = r.Remove(second)
+		Expect(err).NotTo(HaveOccurred())
+
+		reopen()
+
+		third := domain.NewURLGetTask("@daily", "http://localhost/", logger)
+		err = r.Add(third)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(third.ID()).To(BeNumerically(">", second.ID()))
+	})
+
+	Describe("shared by several instances", func() {
+		var (
+			otherDB *sql.DB
+			other   *registry.SQLTaskRegistry
+		)
+
+		BeforeEach(func() {
+			var err error
+			otherDB, err = sql.Open("sqlite3", path)
+			Expect(err).NotTo(HaveOccurred())
+
+			other, err = registry.NewSQLTaskRegistry(otherDB, registry.NewSequentialIDGenerator(), logger)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			otherDB.Close()
+		})
+
+		It("assigns different IDs to tasks added through each instance", func() {
+			task := domain.NewURLGetTask("@daily", "http://localhost/a", logger)
+			err := r.Add(task)
+			Expect(err).NotTo(HaveOccurred())
+
+			otherTask := domain.NewURLGetTask("@daily", "http://localhost/b", logger)
+			err = other.Add(otherTask)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(otherTask.ID()).NotTo(Equal(task.ID()))
+
+			var count int
+			err = db.QueryRow(`SELECT COUNT(*) FROM tasks`).Scan(&count)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(count).To(Equal(2))
+		})
+
+		It("reflects changes made through other instances", func() {
+			task := domain.NewURLGetTask("@daily", "http://localhost/", logger)
+			err := other.Add(task)
+			Expect(err).NotTo(HaveOccurred())
+
+			restored, err := r.ByID(task.ID())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(restored).NotTo(BeNil())
+			Expect(restored.AsJSON()).To(Equal(task.AsJSON()))
+
+			task.SetSchedule("@hourly")
+			_, err = other.Update(task)
+			Expect(err).NotTo(HaveOccurred())
+
+			allTasks, err := r.All()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(allTasks).To(HaveLen(1))
+			Expect(allTasks[0].Schedule()).To(Equal("@hourly"))
+
+			err = other.Remove(task)
+			Expect(err).NotTo(HaveOccurred())
+
+			allTasks, err = r.All()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(allTasks).To(HaveLen(0))
+		})
+
+		It("records changes made through other instances, but not its own", func() {
+			task := domain.NewURLGetTask("@daily", "http://localhost/", logger)
+			err := r.Add(task)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r.Changes()).To(BeEmpty())
+
+			err = other.Sync()
+			Expect(err).NotTo(HaveOccurred())
+			changes := other.Changes()
+			Expect(changes).To(HaveLen(1))
+			Expect(changes[0].Previous).To(BeNil())
+			Expect(changes[0].Current.AsJSON()).To(Equal(task.AsJSON()))
+			Expect(other.Changes()).To(BeEmpty())
+
+			task.SetSchedule("@hourly")
+			_, err = r.Update(task)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = other.Sync()
+			Expect(err).NotTo(HaveOccurred())
+			replaced := changes[0].Current
+			changes = other.Changes()
+			Expect(changes).To(HaveLen(1))
+			Expect(changes[0].Previous).To(Equal(replaced))
+			Expect(changes[0].Current.Schedule()).To(Equal("@hourly"))
+
+			err = r.Remove(task)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = other.Sync()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(other.Changes()).To(Equal([]registry.TaskChange{{Previous: changes[0].Current}}))
+			Expect(r.Changes()).To(BeEmpty())
+		})
+
+		It("assigns another ID when the ID is taken through another instance first", func() {
+			var taken domain.Task
+			racing := &racingIDGenerator{
+				ids: []uint{1, 2},
+				race: func() {
+					taken = domain.NewURLGetTask("@daily", "http://localhost/a", logger)
+					err := r.Add(taken)
+					Expect(err).NotTo(HaveOccurred())
+				},
+			}
+
+			racer, err := registry.NewSQLTaskRegistry(otherDB, racing, logger)
+			Expect(err).NotTo(HaveOccurred())
+
+			task := domain.NewURLGetTask("@daily", "http://localhost/b", logger)
+			err = racer.Add(task)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(taken.ID()).To(Equal(uint(1)))
+			Expect(task.ID()).To(Equal(uint(2)))
+
+			allTasks, err := r.All()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(allTasks).To(HaveLen(2))
+			Expect(allTasks[1].AsJSON()).To(Equal(task.AsJSON()))
+		})
+
+		It("grants the lease to one instance at a time until it expires", func() {
+			lease, err := registry.NewSQLLease(db)
+			Expect(err).NotTo(HaveOccurred())
+			otherLease, err := registry.NewSQLLease(otherDB)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(lease.Acquire(time.Hour)).To(BeTrue())
+			Expect(otherLease.Acquire(time.Hour)).To(BeFalse())
+			Expect(lease.Acquire(time.Millisecond)).To(BeTrue())
+
+			time.Sleep(5 * time.Millisecond)
+			Expect(otherLease.Acquire(time.Hour)).To(BeTrue())
+			Expect(lease.Acquire(time.Hour)).To(BeFalse())
+		})
+
+		It("fails to update tasks removed through another instance", func() {
+			task := domain.NewURLGetTask("@daily", "http://localhost/", logger)
+			err := r.Add(task)
+			Expect(err).NotTo(HaveOccurred())
+
+			otherTask, err := other.ByID(task.ID())
+			Expect(err).NotTo(HaveOccurred())
+			err = other.Remove(otherTask)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = r.Update(task)
+			Expect(err).To(MatchError(fmt.Sprintf("Task not found for ID: %d", task.ID())))
+		})
+	})
+
+	It("deletes removed tasks", func() {
+		task := domain.NewURLGetTask("@daily", "http://localhost/", logger)
+		err := r.Add(task)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = r.Remove(task)
+		Expect(err).NotTo(HaveOccurred())
+
+		reopen()
+
+		allTasks, err := r.All()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(allTasks).To(HaveLen(0))
+	})
+})
+
+// racingIDGenerator calls race before returning its first ID, so that
+// another instance can take that ID in the meantime.
+type racingIDGenerator struct {
+	ids  []uint
+	race func()
+}
+
+func (g *racingIDGenerator) NextID() uint {
+	if g.race != nil {
+		race := g.race
+		g.race = nil
+		race()
+	}
+
+	id := g.ids[0]
+	g.ids = g.ids[1:]
+	return id
+}
+
+func (g *racingIDGenerator) Observe(uint) {}
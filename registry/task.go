@@ -1,14 +1,16 @@
 package registry
 
 import (
-	"math/rand"
+	"fmt"
+	"sort"
+	"sync"
 
 	"github.com/prodda/prodda/domain"
 )
 
 type TaskRegistry interface {
 
-	// All returns all the tasks known to the registry.
+	// All returns all the tasks known to the registry, ordered by ID.
 	// If no tasks exist, but the interrogation was otherwise successful,
 	// the returned error will be nil.
 	All() ([]domain.Task, error)
@@ -22,6 +24,8 @@ type TaskRegistry interface {
 	// both the returned error and task will be nil.
 	ByID(ID uint) (domain.Task, error)
 
+	// Update replaces the task having the same ID as the given task,
+	// returning the given task.
 	// Update will return an error if the task does not exist.
 	// Callers are expected to first verify that the task exists,
 	// e.g. via ByID.
@@ -33,77 +37,153 @@ type TaskRegistry interface {
 	Remove(task domain.Task) error
 }
 
+// TaskChange is a change made to a task other than via a registry, e.g. by
+// another prodda instance sharing its store. Previous is nil for tasks which
+// have been added, and Current is nil for tasks which have been removed.
+type TaskChange struct {
+	Previous domain.Task
+	Current  domain.Task
+}
+
+// SharedTaskRegistry is a TaskRegistry whose store may be shared by several
+// prodda instances, so that its tasks may be changed by other instances.
+type SharedTaskRegistry interface {
+	TaskRegistry
+
+	// Sync brings the registry up to date with changes made by other
+	// instances. Registries may also sync whenever tasks are read.
+	Sync() error
+
+	// Changes returns the changes made by other instances which have been
+	// found since Changes was last called, in the order they were found.
+	Changes() []TaskChange
+}
+
+// InMemoryTaskRegistry is safe for concurrent use.
 type InMemoryTaskRegistry struct {
-	tasks []domain.Task
+	mutex       sync.RWMutex
+	tasks       []domain.Task // ordered by ID
+	idGenerator IDGenerator
+}
+
+func NewInMemoryTaskRegistry(idGenerator IDGenerator) TaskRegistry {
+	return newInMemoryTaskRegistry(idGenerator)
 }
 
-func NewInMemoryTaskRegistry() TaskRegistry {
+func newInMemoryTaskRegistry(idGenerator IDGenerator) *InMemoryTaskRegistry {
 	return &InMemoryTaskRegistry{
-		tasks: []domain.Task{},
+		tasks:       []domain.Task{},
+		idGenerator: idGenerator,
 	}
 }
 
-func (r InMemoryTaskRegistry) All() ([]domain.Task, error) {
-	return r.tasks, nil
+// All returns a snapshot of the tasks; subsequent changes to the registry
+// are not reflected in the returned slice.
+func (r *InMemoryTaskRegistry) All() ([]domain.Task, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	allTasks := make([]domain.Task, len(r.tasks))
+	copy(allTasks, r.tasks)
+	return allTasks, nil
 }
 
 func (r *InMemoryTaskRegistry) Add(p domain.Task) error {
-	err := p.SetID(r.uniqueRandomID())
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	err := p.SetID(r.uniqueID())
 	if err != nil {
 		return err
 	}
 
-	r.tasks = append(r.tasks, p)
+	r.store(p)
 	return nil
 }
 
-func (r InMemoryTaskRegistry) uniqueRandomID() uint {
-	newID := uint(rand.Uint32())
-	existingTask, _ := r.ByID(newID)
-	for existingTask != nil {
-		newID := uint(rand.Uint32())
-		existingTask, _ = r.ByID(newID)
+// insert stores a task which has already been assigned an ID,
+// e.g. one restored from persistent storage.
+func (r *InMemoryTaskRegistry) insert(p domain.Task) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.idGenerator.Observe(p.ID())
+	r.store(p)
+}
+
+// observe informs the ID generator of an ID which has been in use, e.g. by a
+// task since removed, so that it is not reused.
+func (r *InMemoryTaskRegistry) observe(id uint) {
+	r.idGenerator.Observe(id)
+}
+
+// store must be called with the mutex held.
+func (r *InMemoryTaskRegistry) store(p domain.Task) {
+	i := r.searchID(p.ID())
+	r.tasks = append(r.tasks, nil)
+	copy(r.tasks[i+1:], r.tasks[i:])
+	r.tasks[i] = p
+}
+
+// uniqueID must be called with the mutex held.
+func (r *InMemoryTaskRegistry) uniqueID() uint {
+	newID := r.idGenerator.NextID()
+	for newID == 0 || r.indexOf(newID) >= 0 {
+		newID = r.idGenerator.NextID()
 	}
 	return newID
 }
 
-func (r InMemoryTaskRegistry) ByID(ID uint) (domain.Task, error) {
-	_, found, err := r.byID(ID)
-	if err != nil {
-		return nil, err
+func (r *InMemoryTaskRegistry) ByID(ID uint) (domain.Task, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	i := r.indexOf(ID)
+	if i < 0 {
+		return nil, nil
 	}
-	return found, nil
+	return r.tasks[i], nil
 }
 
-func (r InMemoryTaskRegistry) byID(ID uint) (int, domain.Task, error) {
-	allTasks, err := r.All()
-	if err != nil {
-		return 0, nil, err
+// indexOf returns the index of the task with the given ID, or -1 if there is
+// no such task. It must be called with the mutex held.
+func (r *InMemoryTaskRegistry) indexOf(ID uint) int {
+	i := r.searchID(ID)
+	if i < len(r.tasks) && r.tasks[i].ID() == ID {
+		return i
 	}
+	return -1
+}
 
-	for i, p := range allTasks {
-		if p.ID() == ID {
-			return i, p, nil
-		}
-	}
-	return 0, nil, nil
+// searchID returns the index at which a task with the given ID is, or would
+// be, stored. It must be called with the mutex held.
+func (r *InMemoryTaskRegistry) searchID(ID uint) int {
+	return sort.Search(len(r.tasks), func(i int) bool {
+		return r.tasks[i].ID() >= ID
+	})
 }
 
 func (r *InMemoryTaskRegistry) Update(task domain.Task) (domain.Task, error) {
-	found, err := r.ByID(task.ID())
-	if err != nil {
-		return nil, err
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	i := r.indexOf(task.ID())
+	if i < 0 {
+		return nil, fmt.Errorf("Task not found for ID: %d", task.ID())
 	}
 
-	found.SetSchedule(task.Schedule())
+	r.tasks[i] = task
 
-	return found, nil
+	return task, nil
 }
 
 func (r *InMemoryTaskRegistry) Remove(task domain.Task) error {
-	i, _, err := r.byID(task.ID())
-	if err != nil {
-		return err
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	i := r.indexOf(task.ID())
+	if i < 0 {
+		return fmt.Errorf("Task not found for ID: %d", task.ID())
 	}
 
 	r.tasks[i] = nil // explicitly set to nil to avoid memory leaks
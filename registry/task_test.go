@@ -1,6 +1,9 @@
 package registry_test
 
 import (
+	"fmt"
+	"sync"
+
 	"github.com/prodda/prodda/domain"
 	"github.com/prodda/prodda/registry"
 	. "github.com/onsi/ginkgo"
@@ -9,7 +12,7 @@ import (
 
 var _ = Describe("InMemoryTaskRegistry", func() {
 	It("is empty on initialization", func() {
-		r := registry.NewInMemoryTaskRegistry()
+		r := registry.NewInMemoryTaskRegistry(registry.NewSequentialIDGenerator())
 		allTasks, err := r.All()
 		Expect(err).NotTo(HaveOccurred())
 		Expect(allTasks).NotTo(BeNil())
@@ -18,7 +21,7 @@ var _ = Describe("InMemoryTaskRegistry", func() {
 
 	It("stores a task when added", func() {
 		task := &domain.NoOpTask{}
-		r := registry.NewInMemoryTaskRegistry()
+		r := registry.NewInMemoryTaskRegistry(registry.NewSequentialIDGenerator())
 		r.Add(task)
 		allTasks, err := r.All()
 		Expect(err).NotTo(HaveOccurred())
@@ -28,8 +31,79 @@ var _ = Describe("InMemoryTaskRegistry", func() {
 
 	It("assigns a new ID to task when added", func() {
 		task := &domain.NoOpTask{}
-		r := registry.NewInMemoryTaskRegistry()
+		r := registry.NewInMemoryTaskRegistry(registry.NewSequentialIDGenerator())
 		r.Add(task)
 		Expect(task.ID).ToNot(Equal(0))
 	})
+
+	It("returns an error when updating or removing a task which does not exist", func() {
+		task := &domain.NoOpTask{}
+		task.SetID(1234)
+		r := registry.NewInMemoryTaskRegistry(registry.NewSequentialIDGenerator())
+
+		_, err := r.Update(task)
+		Expect(err).To(HaveOccurred())
+
+		err = r.Remove(task)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("returns snapshots which are unaffected by subsequent changes", func() {
+		r := registry.NewInMemoryTaskRegistry(registry.NewSequentialIDGenerator())
+		first := &domain.NoOpTask{}
+		second := &domain.NoOpTask{}
+		r.Add(first)
+		r.Add(second)
+
+		snapshot, err := r.All()
+		Expect(err).NotTo(HaveOccurred())
+
+		err = r.Remove(first)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(snapshot).To(Equal([]domain.Task{first, second}))
+	})
+
+	It("is safe for concurrent use", func() {
+		r := registry.NewInMemoryTaskRegistry(registry.NewSequentialIDGenerator())
+		workers := 10
+		iterations := 50
+
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				for j := 0; j < iterations; j++ {
+					task := domain.NewNoOpTask("@daily", 0, nil)
+					err := r.Add(task)
+					Expect(err).NotTo(HaveOccurred())
+
+					task.SetSchedule(fmt.Sprintf("@every %dm", j+1))
+					_, err = r.Update(task)
+					Expect(err).NotTo(HaveOccurred())
+
+					allTasks, err := r.All()
+					Expect(err).NotTo(HaveOccurred())
+					for _, t := range allTasks {
+						t.AsJSON()
+					}
+
+					found, err := r.ByID(task.ID())
+					Expect(err).NotTo(HaveOccurred())
+					Expect(found.ID()).To(Equal(task.ID()))
+
+					err = r.Remove(task)
+					Expect(err).NotTo(HaveOccurred())
+				}
+			}()
+		}
+		wg.Wait()
+
+		allTasks, err := r.All()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(allTasks).To(HaveLen(0))
+	})
 })
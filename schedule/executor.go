@@ -0,0 +1,363 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/prodda/prodda/domain"
+	"github.com/pivotal-golang/lager"
+	"gopkg.in/robfig/cron.v2"
+)
+
+// Executor runs tasks, classifying, logging and recording every execution.
+// All executions of tasks, scheduled or otherwise, should be made via an
+// Executor, so that the concurrency policy of each task is enforced.
+type Executor struct {
+	recorder domain.RunRecorder
+	logger   lager.Logger
+
+	// ctx is the parent of the context of every run, so that all runs are
+	// cancelled by Cancel.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mutex sync.Mutex
+	// idle is signalled whenever a run completes, and on shutdown.
+	idle *sync.Cond
+	runs map[uint]*taskRuns
+	// inFlight counts the runs in progress.
+	inFlight sync.WaitGroup
+	// draining is closed on shutdown, after which no runs are begun.
+	draining chan struct{}
+}
+
+// taskRuns tracks the runs of a task which are in progress or queued.
+type taskRuns struct {
+	running int
+	queued  bool
+	// generation is incremented by each run which replaces those in progress.
+	generation uint
+	// cancels cancel the runs in progress, keyed by the ID given to each
+	// run by begin, so that they can be replaced.
+	cancels map[uint]context.CancelFunc
+	lastRun uint
+}
+
+// NewExecutor returns an Executor which records every run via recorder,
+// which may be nil.
+func NewExecutor(recorder domain.RunRecorder, logger lager.Logger) *Executor {
+	ctx, cancel := context.WithCancel(context.Background())
+	e := &Executor{
+		recorder: recorder,
+		logger:   logger,
+		ctx:      ctx,
+		cancel:   cancel,
+		runs:     map[uint]*taskRuns{},
+		draining: make(chan struct{}),
+	}
+	e.idle = sync.NewCond(&e.mutex)
+	return e
+}
+
+// Cancel cancels all runs in progress. Runs begun after Cancel is called are
+// cancelled immediately.
+func (e *Executor) Cancel() {
+	e.cancel()
+}
+
+// Shutdown stops the Executor from beginning runs, including those queued and
+// retries, recording them as cancelled instead. It waits up to grace for the
+// runs in progress to complete, then cancels and logs those which remain.
+func (e *Executor) Shutdown(grace time.Duration) {
+	e.mutex.Lock()
+	select {
+	case <-e.draining:
+	default:
+		close(e.draining)
+	}
+	e.idle.Broadcast()
+	e.mutex.Unlock()
+
+	e.logger.Info("Waiting for task runs to complete", lager.Data{"grace": grace.String()})
+
+	done := make(chan struct{})
+	go func() {
+		e.inFlight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		e.logger.Info("Task runs completed")
+	case <-time.After(grace):
+		e.logger.Info("Abandoning task runs", lager.Data{"tasks": e.running()})
+	}
+
+	e.Cancel()
+}
+
+// running returns the number of runs in progress of each task.
+func (e *Executor) running() map[string]int {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	running := map[string]int{}
+	for id, runs := range e.runs {
+		if runs.running > 0 {
+			running[fmt.Sprint(id)] = runs.running
+		}
+	}
+	return running
+}
+
+// Execute runs the task once, subject to its concurrency policy and timeout,
+// returning the record of the run. Failed executions are attempted again as
+// determined by the retry policy of the task, recording each attempt, and the
+// record of the last attempt is returned. Execute blocks while the run is
+// queued, and between attempts. Runs are not begun after Shutdown.
+func (e *Executor) Execute(task domain.Task) domain.Run {
+	ctx, cancel := context.WithCancel(e.ctx)
+	defer cancel()
+
+	runID, replaced, outcome := e.begin(task, cancel)
+	if outcome != "" {
+		now := time.Now()
+		run := domain.Run{
+			TaskID:    task.ID(),
+			StartTime: now,
+			EndTime:   now,
+			Outcome:   outcome,
+		}
+
+		if outcome == domain.RunCancelled {
+			run.Error = "Shutting down"
+			e.logger.Info("Task not started: shutting down", lager.Data{"task": task.AsJSON(), "run": run.AsJSON()})
+		} else {
+			e.logger.Info("Task skipped", lager.Data{"task": task.AsJSON(), "run": run.AsJSON()})
+		}
+
+		e.record(run)
+		return run
+	}
+	defer e.end(task, runID)
+
+	for attempt := 1; ; attempt++ {
+		run, retry := e.attempt(ctx, task, attempt, replaced)
+		if !retry {
+			return run
+		}
+
+		backoff := task.RetryPolicy().Backoff(attempt+1, rand.Float64())
+		e.logger.Info("Task retrying", lager.Data{
+			"task":    task.AsJSON(),
+			"run":     run.AsJSON(),
+			"backoff": backoff.String(),
+		})
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			e.logger.Info("Task retry abandoned", lager.Data{"task": task.AsJSON(), "run": run.AsJSON()})
+			return run
+		case <-e.draining:
+			e.logger.Info("Task retry abandoned: shutting down", lager.Data{"task": task.AsJSON(), "run": run.AsJSON()})
+			return run
+		}
+	}
+}
+
+// attempt executes the task once as part of a run begun via begin, recording
+// the attempt. It returns whether the attempt failed and should be retried.
+func (e *Executor) attempt(
+	ctx context.Context,
+	task domain.Task,
+	attempt int,
+	replaced func() bool,
+) (domain.Run, bool) {
+	run := domain.Run{
+		TaskID:    task.ID(),
+		Attempt:   attempt,
+		StartTime: time.Now(),
+	}
+	e.logger.Info("Task started", lager.Data{"task": task.AsJSON(), "attempt": attempt})
+
+	if timeout := task.Timeout(); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	result, err := task.Execute(ctx)
+
+	run.EndTime = time.Now()
+	run.Result = result
+	if err != nil {
+		run.Error = err.Error()
+	}
+
+	var outcomeErr domain.OutcomeError
+	switch {
+	case replaced():
+		run.Outcome = domain.RunReplaced
+		e.logger.Info("Task replaced", lager.Data{"task": task.AsJSON(), "run": run.AsJSON()})
+	case err != nil && ctx.Err() == context.DeadlineExceeded:
+		run.Outcome = domain.RunTimedOut
+		run.Error = fmt.Sprintf("Timed out after %s: %v", task.Timeout(), err)
+		e.logger.Error("Task timed out", err, lager.Data{"task": task.AsJSON(), "run": run.AsJSON()})
+	case err != nil && e.ctx.Err() != nil:
+		run.Outcome = domain.RunCancelled
+		e.logger.Error("Task cancelled", err, lager.Data{"task": task.AsJSON(), "run": run.AsJSON()})
+	case errors.As(err, &outcomeErr):
+		run.Outcome = outcomeErr.Outcome()
+		e.logger.Error("Task failed", err, lager.Data{"task": task.AsJSON(), "run": run.AsJSON()})
+	case err != nil:
+		run.Outcome = domain.RunFailed
+		e.logger.Error("Task failed", err, lager.Data{"task": task.AsJSON(), "run": run.AsJSON()})
+	default:
+		run.Outcome = domain.RunSucceeded
+		e.logger.Info("Task completed", lager.Data{"task": task.AsJSON(), "run": run.AsJSON()})
+	}
+
+	e.record(run)
+
+	policy := task.RetryPolicy()
+	retry := retryableOutcome(run.Outcome) &&
+		policy != nil &&
+		attempt < policy.MaxAttempts &&
+		policy.Retryable(ctx, err)
+	return run, retry
+}
+
+func retryableOutcome(outcome string) bool {
+	switch outcome {
+	case domain.RunFailed, domain.RunTimedOut, domain.RunErrored:
+		return true
+	default:
+		return false
+	}
+}
+
+// begin applies the concurrency policy of the task, waiting if the run is
+// queued. If the run must not be begun, it returns the outcome with which to
+// record it, e.g. domain.RunSkipped. Otherwise it returns the ID of the run,
+// to be passed to end, and a func which reports whether the run has since
+// been replaced by another, in which case cancel will have been called.
+func (e *Executor) begin(task domain.Task, cancel context.CancelFunc) (uint, func() bool, string) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.isDraining() {
+		return 0, nil, domain.RunCancelled
+	}
+
+	runs, ok := e.runs[task.ID()]
+	if !ok {
+		runs = &taskRuns{cancels: map[uint]context.CancelFunc{}}
+		e.runs[task.ID()] = runs
+	}
+
+	switch task.ConcurrencyPolicy() {
+	case domain.ConcurrencySkip:
+		if runs.running > 0 {
+			return 0, nil, domain.RunSkipped
+		}
+
+	case domain.ConcurrencyQueue:
+		if runs.running > 0 {
+			if runs.queued {
+				return 0, nil, domain.RunSkipped
+			}
+
+			runs.queued = true
+			for runs.running > 0 && !e.isDraining() {
+				e.idle.Wait()
+			}
+			runs.queued = false
+
+			if e.isDraining() {
+				if runs.running == 0 {
+					delete(e.runs, task.ID())
+				}
+				return 0, nil, domain.RunCancelled
+			}
+		}
+
+	case domain.ConcurrencyReplace:
+		runs.generation++
+		for runID, cancelRun := range runs.cancels {
+			cancelRun()
+			delete(runs.cancels, runID)
+		}
+	}
+
+	runs.running++
+	e.inFlight.Add(1)
+	runs.lastRun++
+	runID := runs.lastRun
+	runs.cancels[runID] = cancel
+	generation := runs.generation
+
+	replaced := func() bool {
+		e.mutex.Lock()
+		defer e.mutex.Unlock()
+
+		return runs.generation != generation
+	}
+	return runID, replaced, ""
+}
+
+func (e *Executor) isDraining() bool {
+	select {
+	case <-e.draining:
+		return true
+	default:
+		return false
+	}
+}
+
+// end records the completion of the run with the given ID, begun via begin.
+func (e *Executor) end(task domain.Task, runID uint) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	runs := e.runs[task.ID()]
+	runs.running--
+	delete(runs.cancels, runID)
+	e.inFlight.Done()
+	if runs.running == 0 && !runs.queued {
+		delete(e.runs, task.ID())
+	}
+	e.idle.Broadcast()
+}
+
+func (e *Executor) record(run domain.Run) {
+	if e.recorder == nil {
+		return
+	}
+
+	err := e.recorder.RecordRun(run)
+	if err != nil {
+		e.logger.Error("Failed to record run", err, lager.Data{"run": run.AsJSON()})
+	}
+}
+
+// Job adapts the task to a cron.Job which executes it via the Executor.
+func (e *Executor) Job(task domain.Task) cron.Job {
+	return job{
+		executor: e,
+		task:     task,
+	}
+}
+
+type job struct {
+	executor *Executor
+	task     domain.Task
+}
+
+func (j job) Run() {
+	j.executor.Execute(j.task)
+}
@@ -0,0 +1,353 @@
+package schedule_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/prodda/prodda/domain"
+	"github.com/prodda/prodda/history"
+	"github.com/prodda/prodda/schedule"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gbytes"
+	"github.com/pivotal-golang/lager/lagertest"
+)
+
+var _ = Describe("Executor", func() {
+	var (
+		logger       *lagertest.TestLogger
+		historyStore *history.InMemoryStore
+		executor     *schedule.Executor
+		task         *fakeTask
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("Executor Test")
+		historyStore = history.NewInMemoryStore(0, 0)
+		executor = schedule.NewExecutor(historyStore, logger)
+
+		task = &fakeTask{}
+		task.SetID(1)
+	})
+
+	It("records and logs successful runs", func() {
+		task.result = domain.Result{"key": "value"}
+
+		run := executor.Execute(task)
+		Expect(run.TaskID).To(Equal(uint(1)))
+		Expect(run.Outcome).To(Equal(domain.RunSucceeded))
+		Expect(run.Result).To(Equal(task.result))
+		Expect(run.EndTime).NotTo(BeTemporally("<", run.StartTime))
+
+		runs, _, err := historyStore.ByTaskID(1, 0, 10)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(runs).To(Equal([]domain.Run{run}))
+
+		Expect(logger.Buffer()).To(Say("started"))
+		Expect(logger.Buffer()).To(Say("completed"))
+	})
+
+	It("records and logs failed runs", func() {
+		task.err = errors.New("some error")
+
+		run := executor.Execute(task)
+		Expect(run.Outcome).To(Equal(domain.RunFailed))
+		Expect(run.Error).To(Equal("some error"))
+
+		runs, _, err := historyStore.ByTaskID(1, 0, 10)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(runs).To(Equal([]domain.Run{run}))
+
+		Expect(logger.Buffer()).To(Say("started"))
+		Expect(logger.Buffer()).To(Say("failed"))
+	})
+
+	It("records failed runs with the outcome determined by their error", func() {
+		task.err = outcomeError{outcome: domain.RunErrored}
+
+		run := executor.Execute(task)
+		Expect(run.Outcome).To(Equal(domain.RunErrored))
+		Expect(run.Error).To(Equal("some errored error"))
+		Expect(logger.Buffer()).To(Say("failed"))
+	})
+
+	It("records runs which exceed the timeout of the task as timed out", func() {
+		task.release = make(chan struct{})
+		task.SetTimeout(10 * time.Millisecond)
+
+		run := executor.Execute(task)
+		Expect(run.Outcome).To(Equal(domain.RunTimedOut))
+		Expect(run.Error).To(ContainSubstring("Timed out after 10ms"))
+		Expect(run.Duration()).To(BeNumerically("<", time.Second))
+		Expect(logger.Buffer()).To(Say("timed out"))
+	})
+
+	It("cancels runs in progress when cancelled", func() {
+		task.release = make(chan struct{})
+
+		runs := make(chan domain.Run, 1)
+		go func(executor *schedule.Executor, task *fakeTask) {
+			runs <- executor.Execute(task)
+		}(executor, task)
+		Eventually(task.Executions).Should(Equal(1))
+
+		executor.Cancel()
+
+		var run domain.Run
+		Eventually(runs).Should(Receive(&run))
+		Expect(run.Outcome).To(Equal(domain.RunCancelled))
+	})
+
+	Describe("retries", func() {
+		var networkErr error
+
+		BeforeEach(func() {
+			networkErr = &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+			task.SetRetryPolicy(&domain.RetryPolicy{
+				MaxAttempts:    3,
+				InitialBackoff: time.Millisecond,
+				Multiplier:     2,
+				RetryOn:        []string{domain.RetryOnNetwork},
+			})
+		})
+
+		It("retries retryable failures, recording and logging every attempt", func() {
+			task.errs = []error{networkErr, networkErr}
+
+			run := executor.Execute(task)
+			Expect(run.Outcome).To(Equal(domain.RunSucceeded))
+			Expect(run.Attempt).To(Equal(3))
+			Expect(task.Executions()).To(Equal(3))
+
+			runs, _, err := historyStore.ByTaskID(1, 0, 10)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(runs).To(HaveLen(3))
+			Expect(runs[0]).To(Equal(run))
+			Expect(runs[1].Attempt).To(Equal(2))
+			Expect(runs[1].Outcome).To(Equal(domain.RunFailed))
+			Expect(runs[2].Attempt).To(Equal(1))
+			Expect(runs[2].Outcome).To(Equal(domain.RunFailed))
+
+			Expect(logger.Buffer()).To(Say("failed"))
+			Expect(logger.Buffer()).To(Say("retrying"))
+			Expect(logger.Buffer()).To(Say("completed"))
+		})
+
+		It("stops after the maximum number of attempts", func() {
+			task.err = networkErr
+
+			run := executor.Execute(task)
+			Expect(run.Outcome).To(Equal(domain.RunFailed))
+			Expect(run.Attempt).To(Equal(3))
+			Expect(task.Executions()).To(Equal(3))
+		})
+
+		It("does not retry failures which are not retryable", func() {
+			task.err = errors.New("some error")
+
+			run := executor.Execute(task)
+			Expect(run.Outcome).To(Equal(domain.RunFailed))
+			Expect(run.Attempt).To(Equal(1))
+			Expect(task.Executions()).To(Equal(1))
+		})
+
+		It("abandons retries when cancelled", func() {
+			task.err = networkErr
+			task.SetRetryPolicy(&domain.RetryPolicy{
+				MaxAttempts:    3,
+				InitialBackoff: time.Hour,
+				Multiplier:     1,
+				RetryOn:        []string{domain.RetryOnNetwork},
+			})
+
+			runs := make(chan domain.Run, 1)
+			go func(executor *schedule.Executor, task *fakeTask) {
+				runs <- executor.Execute(task)
+			}(executor, task)
+			Eventually(logger.Buffer()).Should(Say("retrying"))
+
+			executor.Cancel()
+
+			var run domain.Run
+			Eventually(runs).Should(Receive(&run))
+			Expect(run.Outcome).To(Equal(domain.RunFailed))
+			Expect(task.Executions()).To(Equal(1))
+			Expect(logger.Buffer()).To(Say("retry abandoned"))
+		})
+	})
+
+	It("adapts tasks to cron jobs which execute them", func() {
+		executor.Job(task).Run()
+		Expect(task.Executions()).To(Equal(1))
+
+		_, total, err := historyStore.ByTaskID(1, 0, 10)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(total).To(Equal(1))
+	})
+
+	Describe("shutdown", func() {
+		var firstRun chan domain.Run
+
+		BeforeEach(func() {
+			task.release = make(chan struct{})
+
+			run := make(chan domain.Run, 1)
+			go func(executor *schedule.Executor, task *fakeTask) {
+				run <- executor.Execute(task)
+			}(executor, task)
+			firstRun = run
+			Eventually(task.Executions).Should(Equal(1))
+		})
+
+		It("waits for runs in progress to complete within the grace period", func() {
+			shutdown := make(chan struct{})
+			go func(executor *schedule.Executor) {
+				executor.Shutdown(time.Minute)
+				close(shutdown)
+			}(executor)
+			Consistently(shutdown).ShouldNot(BeClosed())
+
+			close(task.release)
+
+			var run domain.Run
+			Eventually(firstRun).Should(Receive(&run))
+			Expect(run.Outcome).To(Equal(domain.RunSucceeded))
+			Eventually(shutdown).Should(BeClosed())
+			Expect(logger.Buffer()).To(Say("completed"))
+		})
+
+		It("cancels and logs runs in progress after the grace period", func() {
+			executor.Shutdown(10 * time.Millisecond)
+
+			var run domain.Run
+			Eventually(firstRun).Should(Receive(&run))
+			Expect(run.Outcome).To(Equal(domain.RunCancelled))
+			Expect(logger.Buffer()).To(Say(`Abandoning task runs.*"1":1`))
+		})
+
+		It("does not begin runs once shut down", func() {
+			executor.Shutdown(10 * time.Millisecond)
+
+			run := executor.Execute(task)
+			Expect(run.Outcome).To(Equal(domain.RunCancelled))
+			Expect(task.Executions()).To(Equal(1))
+		})
+
+		It("does not begin queued runs once shut down", func() {
+			task.SetConcurrencyPolicy(domain.ConcurrencyQueue)
+
+			queuedRun := make(chan domain.Run, 1)
+			go func(executor *schedule.Executor, task *fakeTask) {
+				queuedRun <- executor.Execute(task)
+			}(executor, task)
+			Consistently(queuedRun).ShouldNot(Receive())
+
+			executor.Shutdown(10 * time.Millisecond)
+
+			var run domain.Run
+			Eventually(queuedRun).Should(Receive(&run))
+			Expect(run.Outcome).To(Equal(domain.RunCancelled))
+			Expect(task.Executions()).To(Equal(1))
+		})
+	})
+
+	Describe("concurrency policies", func() {
+		var (
+			firstRun chan domain.Run
+			outcomes func() []string
+		)
+
+		BeforeEach(func() {
+			task.release = make(chan struct{})
+
+			run := make(chan domain.Run, 1)
+			go func(executor *schedule.Executor, task *fakeTask) {
+				run <- executor.Execute(task)
+			}(executor, task)
+			firstRun = run
+			Eventually(task.Executions).Should(Equal(1))
+
+			outcomes = func() []string {
+				runs, _, err := historyStore.ByTaskID(1, 0, 10)
+				Expect(err).NotTo(HaveOccurred())
+
+				outcomes := []string{}
+				for _, run := range runs {
+					outcomes = append(outcomes, run.Outcome)
+				}
+				return outcomes
+			}
+		})
+
+		AfterEach(func() {
+			close(task.release)
+		})
+
+		It("runs tasks concurrently by default", func() {
+			go executor.Execute(task)
+			Eventually(task.Executions).Should(Equal(2))
+		})
+
+		It("skips runs while a run is in progress with the skip policy", func() {
+			task.SetConcurrencyPolicy(domain.ConcurrencySkip)
+
+			run := executor.Execute(task)
+			Expect(run.Outcome).To(Equal(domain.RunSkipped))
+			Expect(task.Executions()).To(Equal(1))
+			Expect(outcomes()).To(Equal([]string{domain.RunSkipped}))
+			Expect(logger.Buffer()).To(Say("skipped"))
+		})
+
+		It("queues one run while a run is in progress with the queue policy", func() {
+			task.SetConcurrencyPolicy(domain.ConcurrencyQueue)
+
+			queuedRun := make(chan domain.Run, 1)
+			go func(executor *schedule.Executor, task *fakeTask) {
+				queuedRun <- executor.Execute(task)
+			}(executor, task)
+			Consistently(task.Executions).Should(Equal(1))
+
+			run := executor.Execute(task)
+			Expect(run.Outcome).To(Equal(domain.RunSkipped))
+
+			task.release <- struct{}{}
+			Eventually(firstRun).Should(Receive())
+			Eventually(task.Executions).Should(Equal(2))
+
+			task.release <- struct{}{}
+			Eventually(queuedRun).Should(Receive())
+			Expect(outcomes()).To(Equal([]string{
+				domain.RunSucceeded,
+				domain.RunSucceeded,
+				domain.RunSkipped,
+			}))
+		})
+
+		It("cancels and replaces runs in progress with the replace policy", func() {
+			task.SetConcurrencyPolicy(domain.ConcurrencyReplace)
+
+			go executor.Execute(task)
+			Eventually(task.Executions).Should(Equal(2))
+
+			var run domain.Run
+			Eventually(firstRun).Should(Receive(&run))
+			Expect(run.Outcome).To(Equal(domain.RunReplaced))
+			Expect(run.Error).To(Equal(context.Canceled.Error()))
+		})
+	})
+})
+
+type outcomeError struct {
+	outcome string
+}
+
+func (e outcomeError) Error() string {
+	return "some " + e.outcome + " error"
+}
+
+func (e outcomeError) Outcome() string {
+	return e.outcome
+}
@@ -0,0 +1,63 @@
+package schedule_test
+
+import (
+	"context"
+	"sync"
+
+	"github.com/prodda/prodda/domain"
+)
+
+// fakeTask returns the configured result and error from every execution,
+// except that errs, if set, are returned from the first executions in turn.
+// If release is set, each execution blocks until it is closed or sent a value,
+// or the execution is cancelled.
+type fakeTask struct {
+	domain.BaseTask
+
+	mutex      sync.Mutex
+	result     domain.Result
+	err        error
+	errs       []error
+	executions int
+	release    chan struct{}
+}
+
+func (t *fakeTask) Type() string {
+	return "fake"
+}
+
+func (t *fakeTask) Execute(ctx context.Context) (domain.Result, error) {
+	t.mutex.Lock()
+	t.executions++
+	release := t.release
+	err := t.err
+	if len(t.errs) > 0 {
+		err, t.errs = t.errs[0], t.errs[1:]
+	}
+	t.mutex.Unlock()
+
+	if release != nil {
+		select {
+		case <-release:
+		case <-ctx.Done():
+			return t.result, ctx.Err()
+		}
+	}
+	return t.result, err
+}
+
+func (t *fakeTask) Executions() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.executions
+}
+
+func (t *fakeTask) AsJSON() domain.TaskJSON {
+	return domain.BaseTaskJson{
+		ID:       t.ID(),
+		Schedule: t.Schedule(),
+		EntryID:  t.EntryID(),
+		Type:     t.Type(),
+	}
+}
@@ -2,20 +2,28 @@ package schedule
 
 import (
 	"os"
+	"time"
 
 	"github.com/pivotal-golang/lager"
 	"gopkg.in/robfig/cron.v2"
 )
 
 type Runner struct {
-	logger lager.Logger
-	c      *cron.Cron
+	logger        lager.Logger
+	c             *cron.Cron
+	executor      *Executor
+	shutdownGrace time.Duration
 }
 
-func NewRunner(c *cron.Cron, logger lager.Logger) Runner {
+// NewRunner returns a Runner which starts the cron, and on being signalled
+// stops it and shuts down the executor, allowing runs in progress up to
+// shutdownGrace to complete.
+func NewRunner(c *cron.Cron, executor *Executor, shutdownGrace time.Duration, logger lager.Logger) Runner {
 	return Runner{
-		logger: logger,
-		c:      c,
+		logger:        logger,
+		c:             c,
+		executor:      executor,
+		shutdownGrace: shutdownGrace,
 	}
 }
 
@@ -27,5 +35,8 @@ func (a Runner) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
 
 	<-signals
 	a.c.Stop()
+	a.logger.Info("Scheduler stopped")
+
+	a.executor.Shutdown(a.shutdownGrace)
 	return nil
 }
@@ -0,0 +1,596 @@
+package schedule
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prodda/prodda/domain"
+	"github.com/prodda/prodda/registry"
+	"github.com/pivotal-golang/lager"
+	"gopkg.in/robfig/cron.v2"
+)
+
+// Scheduler keeps the cron schedule in step with the task registry.
+// Changes are serialized, so that each task is scheduled exactly once
+// however many changes are made concurrently. Paused tasks, and all tasks
+// while the scheduler itself is paused, are kept in the registry but not
+// scheduled. Changes made to a registry.SharedTaskRegistry by other instances
+// are applied to the schedule before each change made via the Scheduler,
+// and periodically once the Scheduler is shared; see Share.
+type Scheduler struct {
+	mutex           sync.Mutex
+	c               *cron.Cron
+	registry        registry.TaskRegistry
+	executor        *Executor
+	minimumInterval time.Duration
+	defaultTimezone string
+	logger          lager.Logger
+	paused          bool
+
+	// lease, if set, elects the instance which runs scheduled tasks.
+	lease     Lease
+	leaseTerm time.Duration
+	// leaseExpiry is when the lease held by the Scheduler expires, or zero
+	// if it is not held. It is guarded by leaseMutex.
+	leaseMutex  sync.RWMutex
+	leaseExpiry time.Time
+}
+
+// Lease elects one of several instances sharing a registry to run scheduled
+// tasks, e.g. registry.SQLLease.
+type Lease interface {
+	// Acquire acquires the lease for term, or renews it if it is already
+	// held, returning whether it is held.
+	Acquire(term time.Duration) (bool, error)
+}
+
+type SchedulerJSON struct {
+	Paused bool `json:"paused"`
+}
+
+// FireTimesJSON describes when a task last ran and will next run on its
+// schedule. All fields are omitted for tasks which are not scheduled.
+type FireTimesJSON struct {
+	NextRun *time.Time  `json:"nextRun,omitempty"`
+	PrevRun *time.Time  `json:"prevRun,omitempty"`
+	Preview []time.Time `json:"preview,omitempty"`
+}
+
+// NewScheduler returns a Scheduler which runs tasks via the executor.
+// Tasks which are added or replaced must not be scheduled to run more often
+// than the minimum interval; see domain.ValidateScheduleFrequency. Schedules
+// of tasks without a time zone are evaluated in the default time zone, or the
+// local time zone if it is empty.
+func NewScheduler(
+	c *cron.Cron,
+	taskRegistry registry.TaskRegistry,
+	executor *Executor,
+	minimumInterval time.Duration,
+	defaultTimezone string,
+	logger lager.Logger) *Scheduler {
+	return &Scheduler{
+		c:               c,
+		registry:        taskRegistry,
+		executor:        executor,
+		minimumInterval: minimumInterval,
+		defaultTimezone: defaultTimezone,
+		logger:          logger,
+	}
+}
+
+// MinimumInterval returns the minimum interval between consecutive scheduled
+// runs of tasks which are added or replaced.
+func (s *Scheduler) MinimumInterval() time.Duration {
+	return s.minimumInterval
+}
+
+// DefaultTimezone returns the time zone in which the schedules of tasks
+// without a time zone are evaluated, or the empty string for the local
+// time zone.
+func (s *Scheduler) DefaultTimezone() string {
+	return s.defaultTimezone
+}
+
+// ScheduleExisting schedules all tasks already known to the registry,
+// e.g. those restored from persistent storage. The minimum interval is not
+// enforced, so that existing tasks are unaffected if it is raised.
+func (s *Scheduler) ScheduleExisting() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	allTasks, err := s.registry.All()
+	if err != nil {
+		return err
+	}
+
+	// Every task found so far is scheduled here.
+	if shared, ok := s.registry.(registry.SharedTaskRegistry); ok {
+		shared.Changes()
+	}
+
+	for _, task := range allTasks {
+		err = s.schedule(task)
+		if err != nil {
+			return err
+		}
+		s.logger.Info("Task restored", lager.Data{"task": task.AsJSON()})
+	}
+	return nil
+}
+
+// Share keeps the schedule in step with a registry shared with other
+// instances, and ensures that only the instance which holds the lease runs
+// scheduled tasks. Every interval, it applies the changes made by other
+// instances to the schedule and acquires or renews the lease, which it holds
+// for three intervals; scheduled runs are skipped while it is not held. Runs
+// made on demand are unaffected. Share must be called before the cron is
+// started.
+func (s *Scheduler) Share(lease Lease, interval time.Duration) error {
+	s.lease = lease
+	s.leaseTerm = 3 * interval
+
+	err := s.Sync()
+	if err != nil {
+		return err
+	}
+
+	s.c.Schedule(cron.Every(interval), cron.FuncJob(func() {
+		err := s.Sync()
+		if err != nil {
+			s.logger.Error("Failed to sync with shared registry", err)
+		}
+	}))
+	return nil
+}
+
+// Sync renews the lease, if the Scheduler is shared, and applies the changes
+// made to a shared registry by other instances to the schedule.
+func (s *Scheduler) Sync() error {
+	s.renewLease()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	shared, ok := s.registry.(registry.SharedTaskRegistry)
+	if !ok {
+		return nil
+	}
+
+	err := shared.Sync()
+	if err != nil {
+		return err
+	}
+
+	s.reconcile()
+	return nil
+}
+
+// Add schedules the task and adds it to the registry.
+func (s *Scheduler) Add(task domain.Task) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.reconcile()
+
+	err := domain.ValidateScheduleFrequency(s.spec(task), s.minimumInterval)
+	if err != nil {
+		return err
+	}
+
+	err = s.schedule(task)
+	if err != nil {
+		return err
+	}
+
+	err = s.registry.Add(task)
+	s.reconcile()
+	if err != nil {
+		s.unschedule(task)
+		return err
+	}
+	return nil
+}
+
+// Replace swaps the task with the given ID for the replacement, which takes
+// on the ID. The replacement is scheduled before the existing task is
+// unscheduled, so if an error is returned the existing task is unaffected.
+func (s *Scheduler) Replace(ID uint, replacement domain.Task) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.reconcile()
+
+	existing, err := s.registry.ByID(ID)
+	s.reconcile()
+	if err != nil {
+		return err
+	}
+
+	if existing == nil {
+		return fmt.Errorf("Task not found for ID: %d", ID)
+	}
+
+	err = domain.ValidateScheduleFrequency(s.spec(replacement), s.minimumInterval)
+	if err != nil {
+		return err
+	}
+
+	err = replacement.SetID(ID)
+	if err != nil {
+		return err
+	}
+
+	err = s.schedule(replacement)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.registry.Update(replacement)
+	if err != nil {
+		s.unschedule(replacement)
+		return err
+	}
+
+	s.unschedule(existing)
+	return nil
+}
+
+// Remove unschedules the task and removes it from the registry.
+func (s *Scheduler) Remove(task domain.Task) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	task, err := s.current(task)
+	if err != nil {
+		return err
+	}
+
+	s.unschedule(task)
+	return s.registry.Remove(task)
+}
+
+// Pause unschedules the task and records it as paused in the registry.
+// Pausing a paused task has no effect.
+func (s *Scheduler) Pause(task domain.Task) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	task, err := s.current(task)
+	if err != nil {
+		return err
+	}
+
+	if task.Paused() {
+		return nil
+	}
+
+	task.SetPaused(true)
+	_, err = s.registry.Update(task)
+	if err != nil {
+		task.SetPaused(false)
+		return err
+	}
+
+	s.unschedule(task)
+	return nil
+}
+
+// Resume records the task as no longer paused in the registry and schedules
+// it, unless the scheduler is paused. Resuming an unpaused task has no effect.
+func (s *Scheduler) Resume(task domain.Task) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	task, err := s.current(task)
+	if err != nil {
+		return err
+	}
+
+	if !task.Paused() {
+		return nil
+	}
+
+	task.SetPaused(false)
+	err = s.schedule(task)
+	if err != nil {
+		task.SetPaused(true)
+		return err
+	}
+
+	_, err = s.registry.Update(task)
+	if err != nil {
+		s.unschedule(task)
+		task.SetPaused(true)
+		return err
+	}
+	return nil
+}
+
+// PauseAll unschedules every task, without changing whether each task is
+// paused, until ResumeAll is called. Tasks added or updated in the meantime
+// are not scheduled.
+func (s *Scheduler) PauseAll() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.paused {
+		return nil
+	}
+
+	s.reconcile()
+	allTasks, err := s.registry.All()
+	s.reconcile()
+	if err != nil {
+		return err
+	}
+
+	s.paused = true
+	for _, task := range allTasks {
+		s.unschedule(task)
+	}
+	return nil
+}
+
+// ResumeAll schedules every task which is not itself paused.
+func (s *Scheduler) ResumeAll() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.paused {
+		return nil
+	}
+
+	s.reconcile()
+	allTasks, err := s.registry.All()
+	s.reconcile()
+	if err != nil {
+		return err
+	}
+
+	s.paused = false
+	for _, task := range allTasks {
+		err = s.schedule(task)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Paused returns whether the scheduler is paused via PauseAll.
+func (s *Scheduler) Paused() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.paused
+}
+
+// FireTimes returns when the task last ran and will next run on its schedule,
+// along with the next preview fire times of the task, starting with the next.
+// Times are given in the time zone of the schedule. Runs made on demand are
+// not included.
+func (s *Scheduler) FireTimes(task domain.Task, preview int) FireTimesJSON {
+	var fireTimes FireTimesJSON
+
+	entryID := task.EntryID()
+	if entryID == 0 {
+		return fireTimes
+	}
+
+	entry := s.c.Entry(entryID)
+	if !entry.Valid() {
+		return fireTimes
+	}
+
+	next := entry.Next
+	if next.IsZero() {
+		// The cron has not been started, so has not yet calculated the
+		// next fire time of the entry.
+		next = entry.Schedule.Next(time.Now())
+	}
+
+	if !next.IsZero() {
+		fireTimes.NextRun = &next
+	}
+
+	if !entry.Prev.IsZero() {
+		prev := entry.Prev
+		fireTimes.PrevRun = &prev
+	}
+
+	if !next.IsZero() && preview > 0 {
+		fireTimes.Preview = append(
+			[]time.Time{next},
+			domain.NextFireTimes(entry.Schedule, next, preview-1)...)
+	}
+
+	if spec, ok := entry.Schedule.(*cron.SpecSchedule); ok {
+		fireTimes.in(spec.Location)
+	}
+
+	return fireTimes
+}
+
+func (f *FireTimesJSON) in(location *time.Location) {
+	if f.NextRun != nil {
+		next := f.NextRun.In(location)
+		f.NextRun = &next
+	}
+
+	if f.PrevRun != nil {
+		prev := f.PrevRun.In(location)
+		f.PrevRun = &prev
+	}
+
+	for i := range f.Preview {
+		f.Preview[i] = f.Preview[i].In(location)
+	}
+}
+
+func (s *Scheduler) AsJSON() SchedulerJSON {
+	return SchedulerJSON{
+		Paused: s.Paused(),
+	}
+}
+
+// spec returns the cron spec of the task, evaluated in its time zone.
+func (s *Scheduler) spec(task domain.Task) string {
+	timezone := task.Timezone()
+	if timezone == "" {
+		timezone = s.defaultTimezone
+	}
+	return domain.ScheduleInTimezone(task.Schedule(), timezone)
+}
+
+// schedule adds a cron entry for the task, unless either the task or the
+// scheduler is paused, in which case the task is left without an entry once
+// its schedule has been validated.
+func (s *Scheduler) schedule(task domain.Task) error {
+	if s.paused || task.Paused() {
+		_, err := domain.ParseSchedule(s.spec(task))
+		if err != nil {
+			return err
+		}
+		task.SetEntryID(0)
+		return nil
+	}
+
+	entryID, err := s.c.AddJob(s.spec(task), s.job(task))
+	if err != nil {
+		return err
+	}
+	task.SetEntryID(entryID)
+	return nil
+}
+
+// unschedule removes the cron entry for the task, if it has one.
+func (s *Scheduler) unschedule(task domain.Task) {
+	if task.EntryID() == 0 {
+		return
+	}
+
+	s.c.Remove(task.EntryID())
+	task.SetEntryID(0)
+}
+
+// job returns a cron.Job which executes the task via the executor, unless
+// the Scheduler is shared and does not hold the lease.
+func (s *Scheduler) job(task domain.Task) cron.Job {
+	return leaderJob{
+		scheduler: s,
+		job:       s.executor.Job(task),
+		task:      task,
+	}
+}
+
+type leaderJob struct {
+	scheduler *Scheduler
+	job       cron.Job
+	task      domain.Task
+}
+
+func (j leaderJob) Run() {
+	if !j.scheduler.leads() {
+		j.scheduler.logger.Debug("Task run left to the lease holder", lager.Data{"task": j.task.AsJSON()})
+		return
+	}
+	j.job.Run()
+}
+
+// leads returns whether the Scheduler runs scheduled tasks: either it is not
+// shared, or it holds the lease.
+func (s *Scheduler) leads() bool {
+	if s.lease == nil {
+		return true
+	}
+
+	s.leaseMutex.RLock()
+	defer s.leaseMutex.RUnlock()
+
+	return time.Now().Before(s.leaseExpiry)
+}
+
+// renewLease acquires or renews the lease, if the Scheduler is shared,
+// logging whenever it is acquired or lost.
+func (s *Scheduler) renewLease() {
+	if s.lease == nil {
+		return
+	}
+
+	start := time.Now()
+	held, err := s.lease.Acquire(s.leaseTerm)
+	if err != nil {
+		s.logger.Error("Failed to acquire lease", err)
+	}
+
+	leading := s.leads()
+
+	s.leaseMutex.Lock()
+	defer s.leaseMutex.Unlock()
+
+	if err != nil || !held {
+		s.leaseExpiry = time.Time{}
+		if leading {
+			s.logger.Info("Lease lost; no longer running scheduled tasks")
+		}
+		return
+	}
+
+	s.leaseExpiry = start.Add(s.leaseTerm)
+	if !leading {
+		s.logger.Info("Lease acquired; running scheduled tasks")
+	}
+}
+
+// reconcile applies the changes made to a shared registry by other instances
+// to the schedule: the instances of tasks which have been changed or removed
+// are unscheduled, and those which replace them are scheduled. It must be
+// called with the mutex held.
+func (s *Scheduler) reconcile() {
+	shared, ok := s.registry.(registry.SharedTaskRegistry)
+	if !ok {
+		return
+	}
+
+	for _, change := range shared.Changes() {
+		if change.Previous != nil {
+			s.unschedule(change.Previous)
+		}
+
+		if change.Current == nil {
+			s.logger.Info("Task removed by another instance", lager.Data{"task": change.Previous.AsJSON()})
+			continue
+		}
+
+		err := s.schedule(change.Current)
+		if err != nil {
+			s.logger.Error("Failed to schedule task changed by another instance", err, lager.Data{"task": change.Current.AsJSON()})
+			continue
+		}
+		s.logger.Info("Task changed by another instance", lager.Data{"task": change.Current.AsJSON()})
+	}
+}
+
+// current returns the instance of the task held by a shared registry, which
+// differs from the given instance if another instance has since changed the
+// task, having applied such changes to the schedule. It returns an error if
+// the task has been removed. Tasks held by other registries are returned as
+// they are. It must be called with the mutex held.
+func (s *Scheduler) current(task domain.Task) (domain.Task, error) {
+	if _, ok := s.registry.(registry.SharedTaskRegistry); !ok {
+		return task, nil
+	}
+
+	s.reconcile()
+	current, err := s.registry.ByID(task.ID())
+	s.reconcile()
+	if err != nil {
+		return nil, err
+	}
+
+	if current == nil {
+		return nil, fmt.Errorf("Task not found for ID: %d", task.ID())
+	}
+	return current, nil
+}
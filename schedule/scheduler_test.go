@@ -0,0 +1,375 @@
+package schedule_test
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/prodda/prodda/domain"
+	"github.com/prodda/prodda/history"
+	"github.com/prodda/prodda/registry"
+	"github.com/prodda/prodda/schedule"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+	"gopkg.in/robfig/cron.v2"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var _ = Describe("Scheduler", func() {
+	var (
+		c            *cron.Cron
+		taskRegistry registry.TaskRegistry
+		scheduler    *schedule.Scheduler
+		task         *fakeTask
+	)
+
+	BeforeEach(func() {
+		logger := lagertest.NewTestLogger("Scheduler Test")
+		executor := schedule.NewExecutor(history.NewInMemoryStore(0, 0), logger)
+
+		c = cron.New()
+		taskRegistry = registry.NewInMemoryTaskRegistry(registry.NewSequentialIDGenerator())
+		scheduler = schedule.NewScheduler(c, taskRegistry, executor, domain.MinimumTaskFrequency, "", logger)
+
+		task = &fakeTask{}
+		task.SetSchedule("@daily")
+
+		err := scheduler.Add(task)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("schedules added tasks", func() {
+		Expect(c.Entries()).To(HaveLen(1))
+		Expect(c.Entries()[0].ID).To(Equal(task.EntryID()))
+	})
+
+	It("does not add or replace tasks which run more often than the minimum interval", func() {
+		frequent := &fakeTask{}
+		frequent.SetSchedule("@every 30s")
+
+		err := scheduler.Add(frequent)
+		Expect(err).To(BeAssignableToTypeOf(domain.ScheduleTooFrequentError{}))
+
+		err = scheduler.Replace(task.ID(), frequent)
+		Expect(err).To(BeAssignableToTypeOf(domain.ScheduleTooFrequentError{}))
+
+		Expect(c.Entries()).To(HaveLen(1))
+		Expect(c.Entries()[0].ID).To(Equal(task.EntryID()))
+	})
+
+	Describe("fire times", func() {
+		It("returns the next fire times of scheduled tasks", func() {
+			hourly := &fakeTask{}
+			hourly.SetSchedule("@every 1h")
+			err := scheduler.Add(hourly)
+			Expect(err).NotTo(HaveOccurred())
+
+			fireTimes := scheduler.FireTimes(hourly, 3)
+			Expect(fireTimes.NextRun).NotTo(BeNil())
+			Expect(*fireTimes.NextRun).To(BeTemporally("~", time.Now().Add(time.Hour), time.Second))
+			Expect(fireTimes.PrevRun).To(BeNil())
+			Expect(fireTimes.Preview).To(HaveLen(3))
+			Expect(fireTimes.Preview[0]).To(Equal(*fireTimes.NextRun))
+			Expect(fireTimes.Preview[2].Sub(fireTimes.Preview[1])).To(Equal(time.Hour))
+		})
+
+		It("evaluates schedules in the time zone of the task, or the default time zone", func() {
+			logger := lagertest.NewTestLogger("Scheduler Test")
+			executor := schedule.NewExecutor(history.NewInMemoryStore(0, 0), logger)
+			scheduler = schedule.NewScheduler(c, taskRegistry, executor, 0, "America/New_York", logger)
+
+			tokyo := &fakeTask{}
+			tokyo.SetSchedule("0 0 3 * * *")
+			tokyo.SetTimezone("Asia/Tokyo")
+			err := scheduler.Add(tokyo)
+			Expect(err).NotTo(HaveOccurred())
+
+			newYork := &fakeTask{}
+			newYork.SetSchedule("0 0 3 * * *")
+			err = scheduler.Add(newYork)
+			Expect(err).NotTo(HaveOccurred())
+
+			tokyoNext := scheduler.FireTimes(tokyo, 0).NextRun
+			Expect(tokyoNext.Location().String()).To(Equal("Asia/Tokyo"))
+			Expect(tokyoNext.Hour()).To(Equal(3))
+
+			newYorkNext := scheduler.FireTimes(newYork, 0).NextRun
+			Expect(newYorkNext.Location().String()).To(Equal("America/New_York"))
+			Expect(newYorkNext.Hour()).To(Equal(3))
+		})
+
+		It("returns no fire times for paused tasks", func() {
+			err := scheduler.Pause(task)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(scheduler.FireTimes(task, 3)).To(Equal(schedule.FireTimesJSON{}))
+		})
+	})
+
+	Describe("pausing tasks", func() {
+		It("unschedules paused tasks, keeping them in the registry", func() {
+			err := scheduler.Pause(task)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(task.Paused()).To(BeTrue())
+			Expect(task.EntryID()).To(BeZero())
+			Expect(c.Entries()).To(BeEmpty())
+
+			registered, err := taskRegistry.ByID(task.ID())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(registered).NotTo(BeNil())
+			Expect(registered.Paused()).To(BeTrue())
+		})
+
+		It("reschedules resumed tasks", func() {
+			err := scheduler.Pause(task)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = scheduler.Resume(task)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(task.Paused()).To(BeFalse())
+			Expect(c.Entries()).To(HaveLen(1))
+			Expect(c.Entries()[0].ID).To(Equal(task.EntryID()))
+		})
+
+		It("does not schedule tasks twice when resumed twice", func() {
+			err := scheduler.Resume(task)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(c.Entries()).To(HaveLen(1))
+		})
+
+		It("does not schedule added tasks which are paused", func() {
+			paused := &fakeTask{}
+			paused.SetSchedule("@hourly")
+			paused.SetPaused(true)
+
+			err := scheduler.Add(paused)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c.Entries()).To(HaveLen(1))
+		})
+
+		It("validates the schedule of added tasks which are paused", func() {
+			paused := &fakeTask{}
+			paused.SetSchedule("invalid")
+			paused.SetPaused(true)
+
+			err := scheduler.Add(paused)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("pausing the scheduler", func() {
+		It("unschedules all tasks until resumed", func() {
+			err := scheduler.PauseAll()
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(scheduler.Paused()).To(BeTrue())
+			Expect(task.Paused()).To(BeFalse())
+			Expect(c.Entries()).To(BeEmpty())
+
+			err = scheduler.ResumeAll()
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(scheduler.Paused()).To(BeFalse())
+			Expect(c.Entries()).To(HaveLen(1))
+			Expect(c.Entries()[0].ID).To(Equal(task.EntryID()))
+		})
+
+		It("does not schedule tasks added or resumed while paused", func() {
+			err := scheduler.Pause(task)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = scheduler.PauseAll()
+			Expect(err).NotTo(HaveOccurred())
+
+			added := &fakeTask{}
+			added.SetSchedule("@hourly")
+			err = scheduler.Add(added)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = scheduler.Resume(task)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c.Entries()).To(BeEmpty())
+
+			err = scheduler.ResumeAll()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c.Entries()).To(HaveLen(2))
+		})
+
+		It("leaves paused tasks unscheduled when resumed", func() {
+			err := scheduler.Pause(task)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = scheduler.PauseAll()
+			Expect(err).NotTo(HaveOccurred())
+
+			err = scheduler.ResumeAll()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c.Entries()).To(BeEmpty())
+		})
+	})
+})
+
+var _ = Describe("Scheduler shared by several instances", func() {
+	// instance is a prodda instance sharing the database.
+	type instance struct {
+		c         *cron.Cron
+		db        *sql.DB
+		registry  *registry.SQLTaskRegistry
+		history   history.Store
+		scheduler *schedule.Scheduler
+	}
+
+	var (
+		dir    string
+		path   string
+		logger *lagertest.TestLogger
+		a, b   *instance
+		task   domain.Task
+	)
+
+	newInstance := func() *instance {
+		db, err := sql.Open("sqlite3", path)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = registry.MigrateSQL(db)
+		Expect(err).NotTo(HaveOccurred())
+
+		sqlRegistry, err := registry.NewSQLTaskRegistry(db, registry.NewTimeOrderedIDGenerator(), logger)
+		Expect(err).NotTo(HaveOccurred())
+
+		i := &instance{
+			c:        cron.New(),
+			db:       db,
+			registry: sqlRegistry,
+			history:  history.NewInMemoryStore(0, 0),
+		}
+		executor := schedule.NewExecutor(i.history, logger)
+		i.scheduler = schedule.NewScheduler(i.c, sqlRegistry, executor, 0, "", logger)
+
+		err = i.scheduler.ScheduleExisting()
+		Expect(err).NotTo(HaveOccurred())
+		return i
+	}
+
+	entries := func(i *instance) []cron.Entry {
+		return i.c.Entries()
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "prodda-schedule")
+		Expect(err).NotTo(HaveOccurred())
+		path = filepath.Join(dir, "tasks.db")
+		logger = lagertest.NewTestLogger("Shared Scheduler Test")
+
+		a = newInstance()
+		b = newInstance()
+
+		task = domain.NewNoOpTask("@daily", 0, logger)
+		err = a.scheduler.Add(task)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = b.scheduler.Sync()
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		a.db.Close()
+		b.db.Close()
+		os.RemoveAll(dir)
+	})
+
+	It("schedules tasks added through other instances", func() {
+		Expect(entries(a)).To(HaveLen(1))
+		Expect(entries(b)).To(HaveLen(1))
+	})
+
+	It("reschedules tasks replaced through other instances", func() {
+		replacement := domain.NewNoOpTask("@hourly", 0, logger)
+		err := a.scheduler.Replace(task.ID(), replacement)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = b.scheduler.Sync()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries(b)).To(HaveLen(1))
+
+		current, err := b.registry.ByID(task.ID())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries(b)[0].ID).To(Equal(current.EntryID()))
+		Expect(current.Schedule()).To(Equal("@hourly"))
+	})
+
+	It("does not schedule tasks twice when resumed after being paused through another instance", func() {
+		err := a.scheduler.Pause(task)
+		Expect(err).NotTo(HaveOccurred())
+
+		current, err := b.registry.ByID(task.ID())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(current.Paused()).To(BeTrue())
+
+		err = b.scheduler.Resume(current)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries(b)).To(HaveLen(1))
+	})
+
+	It("unschedules tasks paused through another instance when paused again", func() {
+		err := a.scheduler.Pause(task)
+		Expect(err).NotTo(HaveOccurred())
+
+		current, err := b.registry.ByID(task.ID())
+		Expect(err).NotTo(HaveOccurred())
+
+		err = b.scheduler.Pause(current)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries(b)).To(BeEmpty())
+	})
+
+	It("unschedules tasks removed through another instance", func() {
+		err := a.scheduler.Remove(task)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = b.scheduler.Sync()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries(b)).To(BeEmpty())
+	})
+
+	It("schedules every task once on restart", func() {
+		err := b.db.Close()
+		Expect(err).NotTo(HaveOccurred())
+		b = newInstance()
+
+		err = b.scheduler.Sync()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries(b)).To(HaveLen(1))
+	})
+
+	It("runs scheduled tasks only on the instance which holds the lease", func() {
+		for _, i := range []*instance{a, b} {
+			lease, err := registry.NewSQLLease(i.db)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = i.scheduler.Share(lease, time.Minute)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		for _, i := range []*instance{a, b} {
+			current, err := i.registry.ByID(task.ID())
+			Expect(err).NotTo(HaveOccurred())
+			i.c.Entry(current.EntryID()).Job.Run()
+		}
+
+		_, aRuns, err := a.history.ByTaskID(task.ID(), 0, 0)
+		Expect(err).NotTo(HaveOccurred())
+		_, bRuns, err := b.history.ByTaskID(task.ID(), 0, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(aRuns).To(Equal(1))
+		Expect(bRuns).To(BeZero())
+	})
+})